@@ -1,13 +1,17 @@
 package cmd
 
 import (
-	"os"
+	"errors"
+	"fmt"
+	"strings"
 
 	log "github.com/sirupsen/logrus"
 	"github.com/spf13/cobra"
 	"github.com/spf13/viper"
 
 	"github.com/vizv/ipfilter/cmd/ipfilter"
+	"github.com/vizv/ipfilter/cmd/ipfilter/config"
+	"github.com/vizv/ipfilter/utils/logging"
 )
 
 var RootCmd = &cobra.Command{
@@ -17,6 +21,14 @@ var RootCmd = &cobra.Command{
 
 TODO: example usage.`,
 	PersistentPreRun: func(cmd *cobra.Command, args []string) {
+		configErr := errors.Join(config.Read(ipfilter.ConfigFile, cmd.Annotations[config.AnnotationCreatesConfig] != ""), config.ReadEnv())
+		logErr := logging.Setup(logging.Options{
+			Format:     viper.GetString("global.log-format"),
+			File:       viper.GetString("global.log-file"),
+			MaxSize:    int64(viper.GetInt("global.log-max-size")) << 20,
+			MaxBackups: viper.GetInt("global.log-max-backups"),
+		})
+
 		if viper.GetBool("global.verbose") {
 			log.SetLevel(log.DebugLevel)
 			log.Debugf("verbose mode enabled")
@@ -25,26 +37,47 @@ TODO: example usage.`,
 			log.SetLevel(log.TraceLevel)
 			log.Tracef("debug mode enabled")
 		}
+
+		if logErr != nil {
+			// keep logging to stdout, so "ipfilter config" still works to fix the settings
+			log.Warnf("%v, logging to stdout in %s format", logErr, logging.FormatText)
+		}
+		if configErr != nil {
+			log.Fatalf("%v", configErr)
+		}
+		if viper.ConfigFileUsed() != "" {
+			log.Debugf("config file: %s", config.ConfigPath())
+		} else {
+			log.Debugf("no config file found in %s, using defaults", strings.Join(config.SearchPaths(), ", "))
+		}
 	},
 }
 
 func init() {
-	viper.SetConfigName("ipfilter")
-	viper.SetConfigType("ini")
-	viper.AddConfigPath(".")
-	if _, err := os.Stat("ipfilter.ini"); err == nil {
-		if err := viper.ReadInConfig(); err != nil {
-			log.Errorf("failed to read config: %+v", err)
-		}
-	}
+	RootCmd.PersistentFlags().StringVar(&ipfilter.ConfigFile, "config", "", fmt.Sprintf("Config file, overrides $%s. (default: the first %s found in ., $XDG_CONFIG_HOME/ipfilter and /etc/ipfilter)", config.ENV_CONFIG, config.DEFAULT_CONFIG_FILE))
 
 	RootCmd.PersistentFlags().BoolVarP(&ipfilter.Verbose, "verbose", "v", false, "Display more verbose output in console output. (default: false)")
-	viper.BindPFlag("global.verbose", RootCmd.PersistentFlags().Lookup("verbose"))
+	config.BindFlag("global.verbose", RootCmd.PersistentFlags().Lookup("verbose"))
 
 	RootCmd.PersistentFlags().BoolVarP(&ipfilter.Debug, "debug", "d", false, "Display debugging output in the console. (default: false)")
-	viper.BindPFlag("global.debug", RootCmd.PersistentFlags().Lookup("debug"))
+	config.BindFlag("global.debug", RootCmd.PersistentFlags().Lookup("debug"))
+
+	RootCmd.PersistentFlags().StringVar(&ipfilter.LogFormat, "log-format", logging.FormatText, fmt.Sprintf("Log format, one of %s. Text is colored when writing to a terminal, unless $NO_COLOR is set. (default: %s)", strings.Join(logging.Formats, ", "), logging.FormatText))
+	config.BindFlag("global.log-format", RootCmd.PersistentFlags().Lookup("log-format"))
+
+	RootCmd.PersistentFlags().StringVar(&ipfilter.LogFile, "log-file", "", "File to write logs to instead of stdout, rotated by size. (empty by default)")
+	config.BindFlag("global.log-file", RootCmd.PersistentFlags().Lookup("log-file"))
+
+	RootCmd.PersistentFlags().IntVar(&ipfilter.LogMaxSize, "log-max-size", logging.DEFAULT_MAX_SIZE, fmt.Sprintf("Size in megabytes after which the log file is rotated, 0 to never rotate. (default: %d)", logging.DEFAULT_MAX_SIZE))
+	config.BindFlag("global.log-max-size", RootCmd.PersistentFlags().Lookup("log-max-size"))
+
+	RootCmd.PersistentFlags().IntVar(&ipfilter.LogMaxBackups, "log-max-backups", logging.DEFAULT_MAX_BACKUPS, fmt.Sprintf("Number of rotated log files kept. (default: %d)", logging.DEFAULT_MAX_BACKUPS))
+	config.BindFlag("global.log-max-backups", RootCmd.PersistentFlags().Lookup("log-max-backups"))
 
-	// RootCmd.AddCommand(ipfilter.ConfigCmd)
+	RootCmd.AddCommand(ipfilter.ConfigCmd)
 	RootCmd.AddCommand(ipfilter.MergeCmd)
 	RootCmd.AddCommand(ipfilter.SyncCmd)
+	RootCmd.AddCommand(ipfilter.SlotsCmd)
+	RootCmd.AddCommand(ipfilter.QBCmd)
+	RootCmd.AddCommand(ipfilter.ServeCmd)
 }
@@ -9,9 +9,16 @@ import (
 var ConfigCmd = &cobra.Command{
 	Use:   "config",
 	Short: "Manage ipfilter config file.",
-	Long:  `Create config file, or get/set config values.`,
+	Long:  `Create config file, get/set/list config values, validate them, or convert the config file to another format.`,
 }
 
 func init() {
 	ConfigCmd.AddCommand(config.CreateCmd)
+	ConfigCmd.AddCommand(config.GetCmd)
+	ConfigCmd.AddCommand(config.SetCmd)
+	ConfigCmd.AddCommand(config.UnsetCmd)
+	ConfigCmd.AddCommand(config.ListCmd)
+	ConfigCmd.AddCommand(config.ValidateCmd)
+	ConfigCmd.AddCommand(config.PathCmd)
+	ConfigCmd.AddCommand(config.ConvertCmd)
 }
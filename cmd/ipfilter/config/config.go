@@ -0,0 +1,188 @@
+package config
+
+import (
+	"fmt"
+	"reflect"
+	"strings"
+
+	"github.com/mitchellh/mapstructure"
+	"github.com/spf13/viper"
+
+	"github.com/vizv/ipfilter/cmd/ipfilter/sync"
+)
+
+// Config is the typed config, decoded from INI, YAML, TOML or JSON config files. Its fields define the known config
+// keys, the check tag names the checker of a key, and marks keys required by their sections.
+type Config struct {
+	Global       GlobalConfig                  `mapstructure:"global"`
+	Sync         SyncConfig                    `mapstructure:"sync"`
+	Serve        ServeConfig                   `mapstructure:"serve"`
+	QBittorrent  map[string]QBittorrentConfig  `mapstructure:"qbittorrent"`
+	Transmission map[string]TransmissionConfig `mapstructure:"transmission"`
+	Deluge       map[string]DelugeConfig       `mapstructure:"deluge"`
+	Webhook      map[string]WebhookConfig      `mapstructure:"webhook"`
+	Exec         map[string]ExecConfig         `mapstructure:"exec"`
+}
+
+type GlobalConfig struct {
+	Verbose       bool   `mapstructure:"verbose,omitempty" check:"bool"`
+	Debug         bool   `mapstructure:"debug,omitempty" check:"bool"`
+	LogFormat     string `mapstructure:"log-format,omitempty" check:"log-format"`
+	LogFile       string `mapstructure:"log-file,omitempty" check:"any"`
+	LogMaxSize    int    `mapstructure:"log-max-size,omitempty" check:"count"`
+	LogMaxBackups int    `mapstructure:"log-max-backups,omitempty" check:"count"`
+}
+
+type SyncConfig struct {
+	DatURLs     []string `mapstructure:"dat-urls,omitempty" check:"source"`
+	Interval    string   `mapstructure:"interval,omitempty" check:"schedule"`
+	CacheDir    string   `mapstructure:"cache-dir,omitempty" check:"cache-dir"`
+	OutputDir   string   `mapstructure:"output-dir,omitempty" check:"dir"`
+	Generations int      `mapstructure:"generations,omitempty" check:"generations"`
+	Mode        string   `mapstructure:"mode,omitempty" check:"mode"`
+	WebUIURL    string   `mapstructure:"webui-url,omitempty" check:"webui-url"`
+	Username    string   `mapstructure:"username,omitempty" check:"any"`
+	Password    string   `mapstructure:"password,omitempty" check:"any"`
+	PathMap     []string `mapstructure:"path-map,omitempty" check:"path-map"`
+	Listen      string   `mapstructure:"listen,omitempty" check:"listen"`
+	MaxAge      string   `mapstructure:"max-age,omitempty" check:"duration"`
+	MaxFailures int      `mapstructure:"max-failures,omitempty" check:"count"`
+}
+
+type ServeConfig struct {
+	Listen string `mapstructure:"listen,omitempty" check:"listen"`
+}
+
+type QBittorrentConfig struct {
+	WebUIURL string   `mapstructure:"webui-url,omitempty" check:"webui-url,required"`
+	Username string   `mapstructure:"username,omitempty" check:"any"`
+	Password string   `mapstructure:"password,omitempty" check:"any"`
+	PathMap  []string `mapstructure:"path-map,omitempty" check:"path-map"`
+}
+
+type TransmissionConfig struct {
+	RPCURL       string   `mapstructure:"rpc-url,omitempty" check:"webui-url,required"`
+	Username     string   `mapstructure:"username,omitempty" check:"any"`
+	Password     string   `mapstructure:"password,omitempty" check:"any"`
+	BlocklistDir string   `mapstructure:"blocklist-dir,omitempty" check:"dir,required"`
+	PathMap      []string `mapstructure:"path-map,omitempty" check:"path-map"`
+}
+
+type DelugeConfig struct {
+	WebURL   string   `mapstructure:"web-url,omitempty" check:"webui-url,required"`
+	Password string   `mapstructure:"password,omitempty" check:"any"`
+	FileURL  bool     `mapstructure:"file-url,omitempty" check:"bool"`
+	PathMap  []string `mapstructure:"path-map,omitempty" check:"path-map"`
+}
+
+type WebhookConfig struct {
+	URL     string `mapstructure:"url,omitempty" check:"http-url,required"`
+	Timeout string `mapstructure:"timeout,omitempty" check:"timeout"`
+}
+
+type ExecConfig struct {
+	Command string `mapstructure:"command,omitempty" check:"any,required"`
+	Timeout string `mapstructure:"timeout,omitempty" check:"timeout"`
+}
+
+// listHook decodes list settings given as comma separated strings in INI, or as lists of strings and maps.
+func listHook(from reflect.Type, to reflect.Type, data any) (any, error) {
+	if to != reflect.TypeOf([]string{}) {
+		return data, nil
+	}
+	return sync.ListSetting(data), nil
+}
+
+// Decode decodes the settings into the typed config, values of wrong types are reported as errors.
+func Decode(v *viper.Viper) (*Config, error) {
+	config := &Config{}
+	if err := v.Unmarshal(config, viper.DecodeHook(listHook)); err != nil {
+		return nil, err
+	}
+	return config, nil
+}
+
+// Settings encodes the config to nested settings to be written to a config file. Lists are joined with commas if
+// structured is false, as INI cannot express lists, otherwise sources with intervals are encoded as {url, interval}.
+func (c *Config) Settings(structured bool) (map[string]any, error) {
+	settings := map[string]any{}
+	encode := func(key string, section any) error {
+		encoded := map[string]any{}
+		if err := mapstructure.Decode(section, &encoded); err != nil {
+			return fmt.Errorf("error encoding %s: %v", key, err)
+		}
+		for name, value := range encoded {
+			if list, ok := value.([]string); ok {
+				encoded[name] = encodeList(list, structured)
+			}
+		}
+		if len(encoded) > 0 {
+			settings[key] = encoded
+		}
+		return nil
+	}
+
+	if err := encode("global", c.Global); err != nil {
+		return nil, err
+	}
+	if err := encode("sync", c.Sync); err != nil {
+		return nil, err
+	}
+	if err := encode("serve", c.Serve); err != nil {
+		return nil, err
+	}
+	for _, sections := range []struct {
+		prefix   string
+		sections any
+	}{
+		{"qbittorrent", c.QBittorrent},
+		{"transmission", c.Transmission},
+		{"deluge", c.Deluge},
+		{"webhook", c.Webhook},
+		{"exec", c.Exec},
+	} {
+		iter := reflect.ValueOf(sections.sections).MapRange()
+		for iter.Next() {
+			if err := encode(sections.prefix+"."+iter.Key().String(), iter.Value().Interface()); err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	return nestSettings(settings), nil
+}
+
+func encodeList(list []string, structured bool) any {
+	if !structured {
+		return strings.Join(list, ",")
+	}
+
+	items := []any{}
+	for _, item := range list {
+		if datURL, interval, ok := strings.Cut(item, "|"); ok {
+			items = append(items, map[string]any{"url": strings.TrimSpace(datURL), "interval": strings.TrimSpace(interval)})
+		} else {
+			items = append(items, item)
+		}
+	}
+	return items
+}
+
+// nestSettings nests "qbittorrent.NAME" sections into "qbittorrent", so they are written as nested maps.
+func nestSettings(settings map[string]any) map[string]any {
+	nested := map[string]any{}
+	for key, value := range settings {
+		prefix, name, ok := strings.Cut(key, ".")
+		if !ok {
+			nested[key] = value
+			continue
+		}
+		sections, _ := nested[prefix].(map[string]any)
+		if sections == nil {
+			sections = map[string]any{}
+			nested[prefix] = sections
+		}
+		sections[name] = value
+	}
+	return nested
+}
@@ -0,0 +1,61 @@
+package config
+
+import (
+	log "github.com/sirupsen/logrus"
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+)
+
+var flagOverwrite bool
+
+var ConvertCmd = &cobra.Command{
+	Use:   "convert OUTPUT",
+	Short: "Convert config file to another format.",
+	Long: `Convert the config file in use, e.g. ipfilter.ini, to the format of OUTPUT by its extension, e.g. ipfilter.yaml.
+Comma separated lists are converted to lists in YAML, TOML and JSON, and sources with intervals to {url, interval}.
+
+Unknown keys are not converted, run "ipfilter config validate" to find them.`,
+	Args: cobra.ExactArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		output := args[0]
+		if viper.ConfigFileUsed() == "" {
+			log.Fatalf("no config file to convert.")
+		}
+
+		file, err := readFile()
+		if err != nil {
+			log.Fatalf("%v", err)
+		}
+		for _, problem := range Validate(file) {
+			log.Warnf("%s", problem)
+		}
+
+		config, err := Decode(file)
+		if err != nil {
+			log.Fatalf("failed to decode config: %v", err)
+		}
+		settings, err := config.Settings(Format(output) != "ini")
+		if err != nil {
+			log.Fatalf("%v", err)
+		}
+
+		converted := newFile(output)
+		if err := converted.MergeConfigMap(settings); err != nil {
+			log.Fatalf("failed to convert config: %v", err)
+		}
+		if flagOverwrite {
+			err = converted.WriteConfigAs(output)
+		} else {
+			err = converted.SafeWriteConfigAs(output)
+		}
+		if err != nil {
+			log.Fatalf("failed to write config: %v", err)
+		}
+
+		log.Infof(`config "%s" converted to "%s".`, ConfigPath(), output)
+	},
+}
+
+func init() {
+	ConvertCmd.Flags().BoolVarP(&flagOverwrite, "force", "f", false, "Overwrite OUTPUT even if already exists. (default: false)")
+}
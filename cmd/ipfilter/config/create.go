@@ -10,11 +10,12 @@ import (
 var flagForce bool
 
 var CreateCmd = &cobra.Command{
-	Use:   "create",
-	Short: "Create ipfilter config file.",
-	Long:  `Create a new ipfilter config file.`,
+	Use:         "create",
+	Short:       "Create ipfilter config file.",
+	Long:        `Create a new ipfilter config file, at the path given by --config if set.`,
+	Annotations: map[string]string{AnnotationCreatesConfig: "true"},
 	Run: func(cmd *cobra.Command, args []string) {
-		err := viper.SafeWriteConfig()
+		err := viper.SafeWriteConfigAs(ConfigPath())
 
 		if err == nil {
 			// new config created
@@ -33,7 +34,7 @@ var CreateCmd = &cobra.Command{
 			return
 		}
 
-		if err := viper.WriteConfig(); err == nil {
+		if err := viper.WriteConfigAs(ConfigPath()); err == nil {
 			// existing config updated
 			log.Infof("config updated.")
 			return
@@ -0,0 +1,118 @@
+package config
+
+import (
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/spf13/pflag"
+	"github.com/spf13/viper"
+)
+
+// ENV_PREFIX prefixes environment variables overriding config keys, e.g. IPFILTER_SYNC_WEBUI_URL for sync.webui-url.
+const ENV_PREFIX = "IPFILTER"
+
+// ENV_FILE_SUFFIX marks environment variables holding the path of a file to read the value from, e.g.
+// IPFILTER_SYNC_PASSWORD_FILE for secrets mounted into containers.
+const ENV_FILE_SUFFIX = "_FILE"
+
+// envKeyReplacer maps config keys to environment variable names.
+var envKeyReplacer = strings.NewReplacer(".", "_", "-", "_")
+
+// flags are command line flags bound to config keys by BindFlag.
+var flags = map[string][]*pflag.Flag{}
+
+// BindFlag binds the flag to the config key like viper.BindPFlag, and remembers the binding so values read from
+// *_FILE variables do not override the flag.
+func BindFlag(key string, flag *pflag.Flag) {
+	flags[key] = append(flags[key], flag)
+	viper.BindPFlag(key, flag)
+}
+
+// flagChanged reports whether a flag bound to the key is set on the command line.
+func flagChanged(key string) bool {
+	for _, flag := range flags[key] {
+		if flag.Changed {
+			return true
+		}
+	}
+	return false
+}
+
+// ReadEnv overrides config keys with environment variables, and reads the values of *_FILE variables from files.
+// Values read from files take the precedence of environment variables: command line flags > environment variables and
+// *_FILE > config file > defaults. They are set in viper instead of the environment, so they are not leaked to child
+// processes. It must be called after the config file is read, so *_FILE variables of configured sections are
+// recognized.
+func ReadEnv() error {
+	bindEnv(viper.GetViper())
+
+	keys := envKeys(viper.GetViper())
+	for _, env := range os.Environ() {
+		name, file, _ := strings.Cut(env, "=")
+		if !strings.HasPrefix(name, ENV_PREFIX+"_") || !strings.HasSuffix(name, ENV_FILE_SUFFIX) {
+			continue
+		}
+
+		// e.g. IPFILTER_GLOBAL_LOG_FILE overrides global.log-file, it is not the file of IPFILTER_GLOBAL_LOG
+		target := strings.TrimSuffix(name, ENV_FILE_SUFFIX)
+		if _, ok := keys[name]; ok {
+			continue
+		}
+		key, ok := keys[target]
+		if !ok {
+			continue
+		}
+		if _, ok := os.LookupEnv(target); ok {
+			return fmt.Errorf("both %s and %s are set", target, name)
+		}
+
+		value, err := os.ReadFile(file)
+		if err != nil {
+			return fmt.Errorf("failed to read %s: %v", name, err)
+		}
+		// viper.Set takes precedence over flags, so it is only set if no flag of the key is set
+		if !flagChanged(key) {
+			viper.Set(key, strings.TrimRight(string(value), "\r\n"))
+		}
+	}
+
+	return nil
+}
+
+func bindEnv(v *viper.Viper) {
+	v.SetEnvPrefix(ENV_PREFIX)
+	v.SetEnvKeyReplacer(envKeyReplacer)
+	v.AutomaticEnv()
+}
+
+// envName returns the environment variable overriding the config key.
+func envName(key string) string {
+	return ENV_PREFIX + "_" + strings.ToUpper(envKeyReplacer.Replace(key))
+}
+
+// envKeys maps environment variable names to the known config keys they override, keys of sections like
+// qbittorrent.NAME are included for the configured sections only.
+func envKeys(v *viper.Viper) map[string]string {
+	sections := map[string]bool{}
+	for _, key := range v.AllKeys() {
+		if parts := strings.Split(key, "."); len(parts) == 3 {
+			sections[parts[0]+"."+parts[1]] = true
+		}
+	}
+
+	keys := map[string]string{}
+	for pattern := range knownKeys {
+		kind, name, ok := strings.Cut(pattern, ".*.")
+		if !ok {
+			keys[envName(pattern)] = pattern
+			continue
+		}
+		for section := range sections {
+			if strings.HasPrefix(section, kind+".") {
+				keys[envName(section+"."+name)] = section + "." + name
+			}
+		}
+	}
+	return keys
+}
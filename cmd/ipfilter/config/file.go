@@ -0,0 +1,163 @@
+package config
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"sort"
+	"strings"
+
+	"github.com/spf13/viper"
+)
+
+// DEFAULT_CONFIG_FILE is the config file created when no config file is found.
+const DEFAULT_CONFIG_FILE = "ipfilter.ini"
+
+// CONFIG_NAME is the name of config files searched for, with any extension in Formats.
+const CONFIG_NAME = "ipfilter"
+
+// Formats are supported config file formats, config files without these extensions are read as INI.
+var Formats = []string{"ini", "yaml", "yml", "toml", "json"}
+
+// ENV_CONFIG specifies the config file when --config is not set.
+const ENV_CONFIG = "IPFILTER_CONFIG"
+
+// AnnotationCreatesConfig marks commands allowed to run before the explicitly specified config file exists.
+const AnnotationCreatesConfig = "creates-config"
+
+// SearchPaths returns directories searched for the config file, in order.
+func SearchPaths() []string {
+	paths := []string{"."}
+	if configDir, err := os.UserConfigDir(); err == nil {
+		paths = append(paths, filepath.Join(configDir, "ipfilter"))
+	}
+	return append(paths, "/etc/ipfilter")
+}
+
+// Format returns the format of the config file by its extension.
+func Format(configFile string) string {
+	ext := strings.ToLower(strings.TrimPrefix(filepath.Ext(configFile), "."))
+	if !slices.Contains(Formats, ext) {
+		return "ini"
+	}
+	return ext
+}
+
+// findConfig returns the first config file in the search paths, preferring INI in the same directory.
+func findConfig() string {
+	for _, dir := range SearchPaths() {
+		for _, format := range Formats {
+			candidate := filepath.Join(dir, CONFIG_NAME+"."+format)
+			if _, err := os.Stat(candidate); err == nil {
+				return candidate
+			}
+		}
+	}
+	return ""
+}
+
+// Read reads the config file specified by --config or $IPFILTER_CONFIG, or the first config file in the search
+// paths. A missing explicitly specified config file is an error unless allowMissing is set, while defaults are used
+// if no config file is found in the search paths.
+func Read(configFile string, allowMissing bool) error {
+	if configFile == "" {
+		configFile = os.Getenv(ENV_CONFIG)
+	}
+	if configFile == "" {
+		if configFile = findConfig(); configFile == "" {
+			return nil
+		}
+	}
+
+	viper.SetConfigFile(configFile)
+	viper.SetConfigType(Format(configFile))
+	if _, err := os.Stat(configFile); err != nil && allowMissing {
+		return nil
+	}
+	if err := viper.ReadInConfig(); err != nil {
+		return fmt.Errorf("failed to read config \"%s\": %v", configFile, err)
+	}
+	return nil
+}
+
+// ConfigPath returns the absolute path of the config file in use, or the path to create it.
+func ConfigPath() string {
+	configPath := viper.ConfigFileUsed()
+	if configPath == "" {
+		configPath = DEFAULT_CONFIG_FILE
+	}
+	if absPath, err := filepath.Abs(configPath); err == nil {
+		configPath = absPath
+	}
+	return configPath
+}
+
+func newFile(configFile string) *viper.Viper {
+	file := viper.New()
+	file.SetConfigFile(configFile)
+	file.SetConfigType(Format(configFile))
+	return file
+}
+
+// ValidateFile reads the config file with environment overrides, and validates it without changing current settings.
+func ValidateFile(configFile string) error {
+	file := newFile(configFile)
+	bindEnv(file)
+	if err := file.ReadInConfig(); err != nil {
+		return fmt.Errorf("failed to read config \"%s\": %v", configFile, err)
+	}
+
+	errs := []error{}
+	for _, problem := range Validate(file) {
+		errs = append(errs, errors.New(problem.String()))
+	}
+	return errors.Join(errs...)
+}
+
+// readFile reads only the config file, without defaults and flags, so it can be written back as is.
+func readFile() (*viper.Viper, error) {
+	file := newFile(ConfigPath())
+	if err := file.ReadInConfig(); err != nil && !errors.Is(err, os.ErrNotExist) {
+		return nil, fmt.Errorf("error reading config file: %v", err)
+	}
+	return file, nil
+}
+
+// writeFile replaces the config file with the settings.
+func writeFile(settings map[string]any) error {
+	file := newFile(ConfigPath())
+	if err := file.MergeConfigMap(settings); err != nil {
+		return fmt.Errorf("error updating config: %v", err)
+	}
+	if err := file.WriteConfig(); err != nil {
+		return fmt.Errorf("error writing config file: %v", err)
+	}
+	return nil
+}
+
+// unsetKey deletes the key from the nested settings, and deletes the sections left empty.
+func unsetKey(settings map[string]any, key string) bool {
+	section, name, nested := strings.Cut(key, ".")
+	if !nested {
+		_, ok := settings[section]
+		delete(settings, section)
+		return ok
+	}
+
+	sub, ok := settings[section].(map[string]any)
+	if !ok || !unsetKey(sub, name) {
+		return false
+	}
+	if len(sub) == 0 {
+		delete(settings, section)
+	}
+	return true
+}
+
+func sortedKeys(v *viper.Viper) []string {
+	keys := v.AllKeys()
+	sort.Strings(keys)
+	return keys
+}
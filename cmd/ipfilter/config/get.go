@@ -0,0 +1,37 @@
+package config
+
+import (
+	"fmt"
+	"strings"
+
+	log "github.com/sirupsen/logrus"
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+)
+
+var GetCmd = &cobra.Command{
+	Use:   "get KEY",
+	Short: "Get a config value.",
+	Long: `Get the effective value of a config key, e.g. "sync.interval", or all values in a section, e.g. "qbittorrent.docker".
+Values not in the config file fall back to defaults.`,
+	Args: cobra.ExactArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		key := strings.ToLower(args[0])
+
+		if section, ok := viper.Get(key).(map[string]any); ok && len(section) > 0 {
+			sub := viper.Sub(key)
+			for _, subKey := range sortedKeys(sub) {
+				fmt.Printf("%s.%s=%s\n", key, subKey, settingString(sub, subKey))
+			}
+			return
+		}
+
+		if !viper.IsSet(key) {
+			if _, ok := lookupKey(key); !ok {
+				log.Fatalf(`unknown key "%s".`, key)
+			}
+			log.Fatalf(`key "%s" not set.`, key)
+		}
+		fmt.Println(settingString(viper.GetViper(), key))
+	},
+}
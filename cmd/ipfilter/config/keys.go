@@ -0,0 +1,419 @@
+package config
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"net/url"
+	"os"
+	"path/filepath"
+	"reflect"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/mitchellh/mapstructure"
+	"github.com/spf13/viper"
+
+	"github.com/vizv/ipfilter/cmd/ipfilter/sync"
+	"github.com/vizv/ipfilter/utils/logging"
+)
+
+// checker validates a config value, empty values are always valid and fall back to defaults.
+type checker func(value string) error
+
+// checkers maps the check tags of Config fields to checkers.
+var checkers = map[string]checker{
+	"any":         checkAny,
+	"bool":        checkBool,
+	"count":       checkCount,
+	"log-format":  checkLogFormat,
+	"source":      checkSource,
+	"schedule":    checkSchedule,
+	"cache-dir":   checkDir(true),
+	"dir":         checkDir(false),
+	"generations": checkGenerations,
+	"mode":        checkMode,
+	"webui-url":   checkWebUIURL,
+	"http-url":    checkHTTPURL,
+	"path-map":    checkPathMap,
+	"listen":      checkListen,
+	"duration":    checkDuration,
+	"timeout":     checkTimeout,
+}
+
+// knownKeys maps every known config key to its checker, "*" matches any section name. Checkers of list keys validate
+// a single item. Keys are derived from the fields of Config, so they cannot drift from the typed config.
+var knownKeys = map[string]checker{}
+
+// requiredKeys are keys without which the section is skipped, tagged with check:"NAME,required".
+var requiredKeys = []string{}
+
+// listKeys are keys accepting lists, see sync.ListSetting.
+var listKeys = map[string]bool{}
+
+func init() {
+	configType := reflect.TypeOf(Config{})
+	for i := 0; i < configType.NumField(); i++ {
+		section := configType.Field(i)
+		prefix, sectionType := fieldName(section), section.Type
+		if sectionType.Kind() == reflect.Map {
+			prefix, sectionType = prefix+".*", sectionType.Elem()
+		}
+
+		for j := 0; j < sectionType.NumField(); j++ {
+			field := sectionType.Field(j)
+			key := prefix + "." + fieldName(field)
+			check, required := strings.CutSuffix(field.Tag.Get("check"), ",required")
+			checker, ok := checkers[check]
+			if !ok {
+				panic(fmt.Sprintf("unknown check %q of config key %s", check, key))
+			}
+
+			knownKeys[key] = checker
+			if required {
+				requiredKeys = append(requiredKeys, key)
+			}
+			if field.Type == reflect.TypeOf([]string{}) {
+				listKeys[key] = true
+			}
+		}
+	}
+}
+
+// fieldName returns the config key name of a Config field.
+func fieldName(field reflect.StructField) string {
+	name, _, _ := strings.Cut(field.Tag.Get("mapstructure"), ",")
+	return name
+}
+
+// Problem is an invalid setting reported by Validate.
+type Problem struct {
+	Key     string
+	Message string
+}
+
+func (p Problem) String() string {
+	return fmt.Sprintf("%s: %s", p.Key, p.Message)
+}
+
+// Validate decodes and type-checks all settings, and reports unknown keys, invalid values and missing required keys.
+func Validate(v *viper.Viper) []Problem {
+	problems := []Problem{}
+	sections := []string{}
+	for _, key := range sortedKeys(v) {
+		pattern, ok := lookupKey(key)
+		if !ok {
+			if isSection(key) {
+				problems = append(problems, Problem{key, "expected a section, not a value"})
+			} else if suggestion := suggestKey(key); suggestion != "" {
+				problems = append(problems, Problem{key, fmt.Sprintf(`unknown key, did you mean "%s"?`, suggestion)})
+			} else {
+				problems = append(problems, Problem{key, "unknown key"})
+			}
+			continue
+		}
+
+		var err error
+		if strings.HasSuffix(pattern, ".path-map") {
+			// structured {host, client} items are checked as is, they are ambiguous when joined as "HOST:CLIENT"
+			_, err = sync.PathMapSetting(v.Get(key))
+		} else if listKeys[pattern] {
+			// items of YAML, TOML and JSON lists are checked as is, they may contain commas
+			err = checkItems(pattern, sync.ListSetting(v.Get(key)))
+		} else {
+			err = checkValue(key, v.GetString(key))
+		}
+		if err != nil {
+			problems = append(problems, Problem{key, err.Error()})
+		}
+
+		if parts := strings.Split(key, "."); len(parts) == 3 && !slices.Contains(sections, parts[0]+"."+parts[1]) {
+			sections = append(sections, parts[0]+"."+parts[1])
+		}
+	}
+
+	for _, section := range sections {
+		kind, name, _ := strings.Cut(section, ".")
+		for _, required := range requiredKeys {
+			if !strings.HasPrefix(required, kind+".*.") {
+				continue
+			}
+			key := strings.Replace(required, "*", name, 1)
+			if v.GetString(key) == "" {
+				problems = append(problems, Problem{key, "required, section skipped without it"})
+			}
+		}
+	}
+
+	// report type errors not reported by checkers, e.g. a section which is not a map
+	if _, err := Decode(v); err != nil {
+		decodeErrors := []string{err.Error()}
+		if decodeErr, ok := err.(*mapstructure.Error); ok {
+			decodeErrors = decodeErr.Errors
+		}
+		for _, decodeError := range decodeErrors {
+			key := ""
+			if match := decodeErrorKey.FindStringSubmatch(decodeError); match != nil {
+				key = match[1]
+			}
+			if !slices.ContainsFunc(problems, func(problem Problem) bool { return problem.Key == key }) {
+				problems = append(problems, Problem{key, decodeError})
+			}
+		}
+	}
+
+	return problems
+}
+
+// decodeErrorKey matches the key in decode errors, e.g. "qbittorrent" in "'qbittorrent[0]' expected a map".
+var decodeErrorKey = regexp.MustCompile(`'([^'\[]+)[^']*'`)
+
+// settingString returns the value of the key as string, with list items joined by commas like in INI.
+func settingString(v *viper.Viper, key string) string {
+	switch value := v.Get(key).(type) {
+	case []any, []string:
+		return strings.Join(sync.ListSetting(value), ",")
+	default:
+		return v.GetString(key)
+	}
+}
+
+// lookupKey returns the pattern in knownKeys matching the key, e.g. "qbittorrent.*.webui-url" for
+// "qbittorrent.docker.webui-url".
+func lookupKey(key string) (string, bool) {
+	if _, ok := knownKeys[key]; ok {
+		return key, true
+	}
+
+	parts := strings.Split(key, ".")
+	if len(parts) != 3 {
+		return "", false
+	}
+	pattern := parts[0] + ".*." + parts[2]
+	_, ok := knownKeys[pattern]
+	return pattern, ok
+}
+
+// isSection reports whether the key is a section, e.g. "sync", "qbittorrent" or "qbittorrent.docker".
+func isSection(key string) bool {
+	for pattern := range knownKeys {
+		parts := strings.Split(pattern, ".")
+		if key == parts[0] || (len(parts) == 3 && strings.Count(key, ".") == 1 && strings.HasPrefix(key, parts[0]+".")) {
+			return true
+		}
+	}
+	return false
+}
+
+// suggestKey returns the known key closest to the unknown key, or empty if none is close enough.
+func suggestKey(key string) string {
+	suggestion, minDistance := "", len(key)/3+1
+	for pattern := range knownKeys {
+		candidate := pattern
+		if parts := strings.Split(key, "."); len(parts) == 3 {
+			candidate = strings.Replace(pattern, "*", parts[1], 1)
+		}
+		if distance := levenshtein(key, candidate); distance < minDistance || (distance == minDistance && candidate < suggestion) {
+			suggestion, minDistance = candidate, distance
+		}
+	}
+	return suggestion
+}
+
+func levenshtein(a, b string) int {
+	previous := make([]int, len(b)+1)
+	for j := range previous {
+		previous[j] = j
+	}
+	for i := 1; i <= len(a); i++ {
+		current := make([]int, len(b)+1)
+		current[0] = i
+		for j := 1; j <= len(b); j++ {
+			cost := 1
+			if a[i-1] == b[j-1] {
+				cost = 0
+			}
+			current[j] = min(previous[j]+1, current[j-1]+1, previous[j-1]+cost)
+		}
+		previous = current
+	}
+	return previous[len(b)]
+}
+
+// checkValue validates the value of a known key.
+func checkValue(key, value string) error {
+	pattern, ok := lookupKey(key)
+	if !ok {
+		return fmt.Errorf("unknown key")
+	}
+	if value == "" {
+		return nil
+	}
+	if listKeys[pattern] {
+		return checkItems(pattern, sync.ListSetting(value))
+	}
+	return knownKeys[pattern](value)
+}
+
+// checkItems validates the items of a list key one by one.
+func checkItems(pattern string, items []string) error {
+	for _, item := range items {
+		if err := knownKeys[pattern](item); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func checkAny(value string) error {
+	return nil
+}
+
+func checkBool(value string) error {
+	if _, err := strconv.ParseBool(value); err != nil {
+		return fmt.Errorf("invalid boolean %q", value)
+	}
+	return nil
+}
+
+func checkSchedule(value string) error {
+	if _, err := sync.ParseSchedule(value); err != nil {
+		return fmt.Errorf("invalid interval or cron expression %q: %v", value, err)
+	}
+	return nil
+}
+
+func checkTimeout(value string) error {
+	timeout, err := sync.ParseInterval(value)
+	if err != nil {
+		return fmt.Errorf("invalid timeout %q: %v", value, err)
+	}
+	if timeout == 0 {
+		return fmt.Errorf("timeout must be positive")
+	}
+	return nil
+}
+
+func checkDuration(value string) error {
+	if _, err := sync.ParseInterval(value); err != nil {
+		return fmt.Errorf("invalid duration %q: %v", value, err)
+	}
+	return nil
+}
+
+func checkCount(value string) error {
+	count, err := strconv.Atoi(value)
+	if err != nil {
+		return fmt.Errorf("invalid number %q", value)
+	}
+	if count < 0 {
+		return fmt.Errorf("must not be negative")
+	}
+	return nil
+}
+
+func checkLogFormat(value string) error {
+	if !slices.Contains(logging.Formats, value) {
+		return fmt.Errorf("unknown log format %q, must be one of %s", value, strings.Join(logging.Formats, ", "))
+	}
+	return nil
+}
+
+func checkSource(value string) error {
+	datURL, rawInterval, hasInterval := strings.Cut(value, "|")
+	datURL = strings.TrimSpace(datURL)
+	if err := checkHTTPURL(datURL); err != nil {
+		return err
+	}
+	if hasInterval {
+		if err := checkSchedule(strings.TrimSpace(rawInterval)); err != nil {
+			return fmt.Errorf("%s: %v", datURL, err)
+		}
+	}
+	return nil
+}
+
+func checkGenerations(value string) error {
+	generations, err := strconv.Atoi(value)
+	if err != nil {
+		return fmt.Errorf("invalid number %q", value)
+	}
+	if generations < sync.MinGenerations || generations > sync.MaxGenerations {
+		return fmt.Errorf("generations must be between %d and %d", sync.MinGenerations, sync.MaxGenerations)
+	}
+	return nil
+}
+
+func checkMode(value string) error {
+	if value != sync.ModeFilter && value != sync.ModeBannedIPs {
+		return fmt.Errorf("unknown mode %q, must be %q or %q", value, sync.ModeFilter, sync.ModeBannedIPs)
+	}
+	return nil
+}
+
+func checkPathMap(value string) error {
+	_, err := sync.ParsePathMapping(value)
+	return err
+}
+
+func checkListen(value string) error {
+	if _, _, err := net.SplitHostPort(value); err != nil {
+		return fmt.Errorf("invalid listen address %q, expecting \"HOST:PORT\" or \":PORT\"", value)
+	}
+	return nil
+}
+
+// checkWebUIURL validates URLs where the http:// scheme may be omitted.
+func checkWebUIURL(value string) error {
+	if !strings.Contains(value, "://") {
+		value = "http://" + value
+	}
+	return checkHTTPURL(value)
+}
+
+func checkHTTPURL(value string) error {
+	parsedURL, err := url.ParseRequestURI(value)
+	if err != nil {
+		return fmt.Errorf("invalid URL %q", value)
+	}
+	if parsedURL.Scheme != "http" && parsedURL.Scheme != "https" {
+		return fmt.Errorf("invalid URL %q, scheme must be http or https", value)
+	}
+	if parsedURL.Host == "" {
+		return fmt.Errorf("invalid URL %q, host is missing", value)
+	}
+	return nil
+}
+
+// checkDir validates the directory is writable, a missing directory is valid if it is created on demand and its
+// nearest existing parent is writable.
+func checkDir(created bool) checker {
+	return func(value string) error {
+		dir, err := filepath.Abs(value)
+		if err != nil {
+			return fmt.Errorf("invalid directory %q: %v", value, err)
+		}
+
+		info, err := os.Stat(dir)
+		for created && errors.Is(err, os.ErrNotExist) && filepath.Dir(dir) != dir {
+			dir = filepath.Dir(dir)
+			info, err = os.Stat(dir)
+		}
+		if err != nil {
+			return fmt.Errorf("directory %q not accessible: %v", dir, err)
+		}
+		if !info.IsDir() {
+			return fmt.Errorf("%q is not a directory", dir)
+		}
+
+		probe, err := os.CreateTemp(dir, ".ipfilter-validate-*")
+		if err != nil {
+			return fmt.Errorf("directory %q not writable: %v", dir, err)
+		}
+		probe.Close()
+		os.Remove(probe.Name())
+		return nil
+	}
+}
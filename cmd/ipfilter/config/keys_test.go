@@ -0,0 +1,149 @@
+package config
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/spf13/viper"
+)
+
+func testViper(t *testing.T, configType, content string) *viper.Viper {
+	t.Helper()
+	v := viper.New()
+	v.SetConfigType(configType)
+	if err := v.ReadConfig(strings.NewReader(content)); err != nil {
+		t.Fatalf("failed to read %s config: %v", configType, err)
+	}
+	return v
+}
+
+func TestValidate(t *testing.T) {
+	tests := []struct {
+		name       string
+		configType string
+		content    string
+		// problems maps keys to a part of the expected message
+		problems map[string]string
+	}{
+		{"valid INI", "ini", `
+[sync]
+dat-urls = https://a/ipfilter.dat|1h, https://b/ipfilter.dat|10 4 * * *
+interval = 15m
+path-map = /srv/ipfilter:/config, /data:D:\downloads
+max-age = 24h
+
+[qbittorrent.box]
+webui-url = http://127.0.0.1:8080
+path-map = C:\ipfilter:/config
+`, map[string]string{}},
+		{"valid YAML with structured items", "yaml", `
+sync:
+  dat-urls:
+    - url: https://a/ipfilter.dat
+      interval: "0 4 * * 1,3"
+    - https://b/ipfilter.dat|CRON_TZ=Asia/Shanghai 0 */6 * * *
+  path-map:
+    - host: /srv/ip,filter
+      client: 'C:\ip:filter'
+    - /data:/downloads
+transmission:
+  home:
+    rpc-url: http://127.0.0.1:9091/transmission/rpc
+    blocklist-dir: /tmp
+`, map[string]string{}},
+		{"suggestions", "ini", `
+[sync]
+intreval = 1h
+dat-url = https://a/ipfilter.dat
+
+[global]
+verbos = true
+
+[qbittorrent.box]
+webui-url = http://127.0.0.1:8080
+pasword = secret
+
+[foo]
+bar = baz
+`, map[string]string{
+			"sync.intreval":           `did you mean "sync.interval"?`,
+			"sync.dat-url":            `did you mean "sync.dat-urls"?`,
+			"global.verbos":           `did you mean "global.verbose"?`,
+			"qbittorrent.box.pasword": `did you mean "qbittorrent.box.password"?`,
+			"foo.bar":                 "unknown key",
+		}},
+		{"sections and required keys", "yaml", `
+qbittorrent: box
+deluge:
+  home:
+    password: secret
+webhook:
+  chat:
+    url: ftp://example.com/hook
+`, map[string]string{
+			"qbittorrent":         "expected a section",
+			"deluge.home.web-url": "required",
+			"webhook.chat.url":    "",
+		}},
+		{"invalid values", "yaml", `
+sync:
+  interval: soon
+  generations: 1
+  mode: unknown
+  dat-urls:
+    - url: https://a/ipfilter.dat
+      interval: never
+  path-map:
+    - host: /srv/ipfilter
+    - /data
+`, map[string]string{
+			"sync.interval":    "soon",
+			"sync.generations": "",
+			"sync.mode":        "unknown",
+			"sync.dat-urls":    "never",
+			"sync.path-map":    "",
+		}},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			problems := Validate(testViper(t, test.configType, test.content))
+			found := map[string]bool{}
+			for _, problem := range problems {
+				found[problem.Key] = true
+				message, ok := test.problems[problem.Key]
+				if !ok {
+					t.Errorf("unexpected problem %s", problem)
+					continue
+				}
+				if !strings.Contains(problem.Message, message) {
+					t.Errorf("problem %s, want message containing %q", problem, message)
+				}
+			}
+			for key := range test.problems {
+				if !found[key] {
+					t.Errorf("no problem reported for %s", key)
+				}
+			}
+		})
+	}
+}
+
+func TestSuggestKey(t *testing.T) {
+	tests := []struct {
+		key  string
+		want string
+	}{
+		{"sync.intervall", "sync.interval"},
+		{"sync.cachedir", "sync.cache-dir"},
+		{"serve.lisen", "serve.listen"},
+		{"deluge.home.web-ulr", "deluge.home.web-url"},
+		{"exec.fw.comand", "exec.fw.command"},
+		{"sync.completely-different", ""},
+		{"x", ""},
+	}
+	for _, test := range tests {
+		if got := suggestKey(test.key); got != test.want {
+			t.Errorf("suggestKey(%q) = %q, want %q", test.key, got, test.want)
+		}
+	}
+}
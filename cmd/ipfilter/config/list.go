@@ -0,0 +1,36 @@
+package config
+
+import (
+	"fmt"
+
+	log "github.com/sirupsen/logrus"
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+)
+
+var flagFileOnly bool
+
+var ListCmd = &cobra.Command{
+	Use:   "list",
+	Short: "List config values.",
+	Long:  `List effective values of all config keys, including defaults, or only values in the config file with --file.`,
+	Args:  cobra.NoArgs,
+	Run: func(cmd *cobra.Command, args []string) {
+		settings := viper.GetViper()
+		if flagFileOnly {
+			file, err := readFile()
+			if err != nil {
+				log.Fatalf("%v", err)
+			}
+			settings = file
+		}
+
+		for _, key := range sortedKeys(settings) {
+			fmt.Printf("%s=%s\n", key, settingString(settings, key))
+		}
+	},
+}
+
+func init() {
+	ListCmd.Flags().BoolVarP(&flagFileOnly, "file", "f", false, "List only values in the config file. (default: false)")
+}
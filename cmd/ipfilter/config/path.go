@@ -0,0 +1,24 @@
+package config
+
+import (
+	"fmt"
+	"os"
+
+	log "github.com/sirupsen/logrus"
+	"github.com/spf13/cobra"
+)
+
+var PathCmd = &cobra.Command{
+	Use:         "path",
+	Short:       "Show config file path.",
+	Long:        `Show the path of the config file in use, or the path "ipfilter config create" creates the config file at.`,
+	Args:        cobra.NoArgs,
+	Annotations: map[string]string{AnnotationCreatesConfig: "true"},
+	Run: func(cmd *cobra.Command, args []string) {
+		configPath := ConfigPath()
+		if _, err := os.Stat(configPath); err != nil {
+			log.Warnf("config file not exists.")
+		}
+		fmt.Println(configPath)
+	},
+}
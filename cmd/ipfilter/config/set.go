@@ -0,0 +1,62 @@
+package config
+
+import (
+	"strings"
+
+	log "github.com/sirupsen/logrus"
+	"github.com/spf13/cobra"
+)
+
+var SetCmd = &cobra.Command{
+	Use:   "set KEY VALUE",
+	Short: "Set a config value.",
+	Long: `Set a config value in the config file, e.g. "ipfilter config set qbittorrent.docker.webui-url localhost:8081".
+The value is validated before saving, the config file is created if not exists.
+
+Note that comments in the config file are not kept.`,
+	Args:        cobra.ExactArgs(2),
+	Annotations: map[string]string{AnnotationCreatesConfig: "true"},
+	Run: func(cmd *cobra.Command, args []string) {
+		key, value := strings.ToLower(args[0]), args[1]
+		if err := checkValue(key, value); err != nil {
+			log.Fatalf(`invalid value for "%s": %v`, key, err)
+		}
+
+		file, err := readFile()
+		if err != nil {
+			log.Fatalf("%v", err)
+		}
+		file.Set(key, value)
+		if err := writeFile(file.AllSettings()); err != nil {
+			log.Fatalf("%v", err)
+		}
+
+		log.Infof(`"%s" set in "%s".`, key, ConfigPath())
+	},
+}
+
+var UnsetCmd = &cobra.Command{
+	Use:   "unset KEY",
+	Short: "Unset a config value.",
+	Long: `Remove a config value, or a whole section, e.g. "qbittorrent.docker", from the config file, so the default is used.
+
+Note that comments in the config file are not kept.`,
+	Args: cobra.ExactArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		key := strings.ToLower(args[0])
+
+		file, err := readFile()
+		if err != nil {
+			log.Fatalf("%v", err)
+		}
+		settings := file.AllSettings()
+		if !unsetKey(settings, key) {
+			log.Fatalf(`key "%s" not set in "%s".`, key, ConfigPath())
+		}
+		if err := writeFile(settings); err != nil {
+			log.Fatalf("%v", err)
+		}
+
+		log.Infof(`"%s" unset in "%s".`, key, ConfigPath())
+	},
+}
@@ -0,0 +1,86 @@
+package config
+
+import (
+	"fmt"
+	"os"
+	"strings"
+
+	log "github.com/sirupsen/logrus"
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+
+	"github.com/vizv/ipfilter/cmd/ipfilter/sync"
+	"github.com/vizv/ipfilter/utils/deluge"
+	"github.com/vizv/ipfilter/utils/transmission"
+)
+
+var flagOnline bool
+
+var ValidateCmd = &cobra.Command{
+	Use:   "validate",
+	Short: "Validate config values.",
+	Long: `Type-check every config value, and report unknown keys which are probably typos.
+With --online, also check qBittorrent, Transmission and Deluge targets are reachable.
+
+When no config file is found, only defaults and environment variables are checked.
+Exit with status 1 if any problem is found, or --config names a missing file.`,
+	Args: cobra.NoArgs,
+	Run: func(cmd *cobra.Command, args []string) {
+		problems := Validate(viper.GetViper())
+		for _, problem := range problems {
+			fmt.Println(problem)
+		}
+
+		unreachable := 0
+		if flagOnline {
+			unreachable = checkOnline()
+		}
+
+		if viper.ConfigFileUsed() == "" {
+			// only defaults and environment variables are validated
+			if count := len(problems) + unreachable; count > 0 {
+				log.Errorf("no config file found in %s, %d problems found in settings.", strings.Join(SearchPaths(), ", "), count)
+				os.Exit(1)
+			}
+			log.Infof("no config file found in %s, settings are valid.", strings.Join(SearchPaths(), ", "))
+			return
+		}
+
+		if count := len(problems) + unreachable; count > 0 {
+			log.Errorf(`%d problems found in "%s".`, count, ConfigPath())
+			os.Exit(1)
+		}
+		log.Infof(`config "%s" is valid.`, ConfigPath())
+	},
+}
+
+// checkOnline connects to all targets, and returns the number of unreachable targets.
+func checkOnline() int {
+	problems := 0
+	report := func(section string, err error) {
+		fmt.Printf("%s: unreachable: %v\n", section, err)
+		problems += 1
+	}
+
+	for _, target := range sync.Targets() {
+		if err := target.Connect(); err != nil {
+			report(target.Section(), err)
+		}
+	}
+	for _, target := range sync.TransmissionTargets() {
+		if err := transmission.NewClient(target.RPCURL).Call("session-get", nil, nil); err != nil {
+			report(target.Section(), err)
+		}
+	}
+	for _, target := range sync.DelugeTargets() {
+		if _, err := deluge.NewClient(target.WebURL); err != nil {
+			report(target.Section(), err)
+		}
+	}
+
+	return problems
+}
+
+func init() {
+	ValidateCmd.Flags().BoolVar(&flagOnline, "online", false, "Also check qBittorrent, Transmission and Deluge targets are reachable. (default: false)")
+}
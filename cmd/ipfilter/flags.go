@@ -2,3 +2,8 @@ package ipfilter
 
 var Verbose bool
 var Debug bool
+var ConfigFile string
+var LogFormat string
+var LogFile string
+var LogMaxSize int
+var LogMaxBackups int
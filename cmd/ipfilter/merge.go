@@ -1,14 +1,15 @@
 package ipfilter
 
 import (
-	"fmt"
-	"os"
+	"bytes"
 
 	log "github.com/sirupsen/logrus"
 	"github.com/spf13/cobra"
 
 	"github.com/vizv/ipfilter/utils/files"
+	"github.com/vizv/ipfilter/utils/format"
 	"github.com/vizv/ipfilter/utils/iprange"
+	"github.com/vizv/ipfilter/utils/logging"
 	"github.com/vizv/ipfilter/utils/parser"
 )
 
@@ -25,34 +26,30 @@ var MergeCmd = &cobra.Command{
 		filesCount := 0
 		rulesCount := 0
 		for _, file := range files.GlobFiles(args) {
-			log.Infof(`collecting rules from "%s"...`, file)
+			log.WithField(logging.FieldFile, file).Infof(`collecting rules from "%s"...`, file)
 			for rule := range parser.ParseIPFilterDatFile(file) {
 				from, to := rule[0], rule[1]
-				log.WithFields(log.Fields{"from": from, "to": to}).Tracef("read rule")
+				log.WithFields(log.Fields{logging.FieldFile: file, "from": from, "to": to}).Tracef("read rule")
 				intervals.Append(from, to)
 				rulesCount += 1
 			}
 			filesCount += 1
 		}
-		log.Infof("%d rules collected from %d files.", rulesCount, filesCount)
+		log.WithField(logging.FieldRules, rulesCount).Infof("%d rules collected from %d files.", rulesCount, filesCount)
 
 		log.Infof("merging rules...")
 		intervals = intervals.Merge()
 		mergedCount := len(intervals)
-		log.Infof("merged to %d rules.", mergedCount)
+		log.WithField(logging.FieldRules, mergedCount).Infof("merged to %d rules.", mergedCount)
 
 		outputFilename := flagOutput
 		log.Infof(`saving rules to "%s"...`, outputFilename)
-		outputFile, err := os.Create(outputFilename)
-		if err != nil {
-			log.Fatalf("failed to create output file: %v", err)
+		outputBuffer := bytes.Buffer{}
+		if err := format.WriteDat(&outputBuffer, intervals); err != nil {
+			log.Fatalf("failed to write merged ipfilter.dat: %+v", err)
 		}
-		defer outputFile.Close()
-
-		for _, interval := range intervals {
-			from, to := interval.From, interval.To
-			log.WithFields(log.Fields{"from": from, "to": to}).Tracef("write rule")
-			fmt.Fprintf(outputFile, "%s - %s , 0 , \n", from, to)
+		if err := files.WriteFileAtomic(outputFilename, outputBuffer.Bytes(), 0o644); err != nil {
+			log.Fatalf("failed to save output file: %v", err)
 		}
 		log.Infof(`merged rules saved to "%s".`, outputFilename)
 	},
@@ -0,0 +1,20 @@
+package ipfilter
+
+import (
+	"github.com/spf13/cobra"
+
+	"github.com/vizv/ipfilter/cmd/ipfilter/qb"
+)
+
+var QBCmd = &cobra.Command{
+	Use:   "qb",
+	Short: "qBittorrent utilities.",
+	Long:  `Check or ban peers connected to the qBittorrent targets configured for sync.`,
+}
+
+func init() {
+	QBCmd.PersistentFlags().StringVarP(&qb.FlagFilter, "filter", "f", "", "ipfilter.dat to match peers against, defaults to the active slot in sync output directory.")
+
+	QBCmd.AddCommand(qb.AuditCmd)
+	QBCmd.AddCommand(qb.BanPeersCmd)
+}
@@ -0,0 +1,121 @@
+package qb
+
+import (
+	"fmt"
+	"os"
+	"sort"
+	"text/tabwriter"
+
+	log "github.com/sirupsen/logrus"
+	"github.com/spf13/cobra"
+
+	"github.com/vizv/ipfilter/cmd/ipfilter/sync"
+)
+
+var flagTop int
+
+var AuditCmd = &cobra.Command{
+	Use:   "audit",
+	Short: "Audit connected peers against the filter.",
+	Long: `List peers currently connected to qBittorrent targets which match the filter, and the most hit ranges.
+
+Connected peers matching the filter should have been blocked, which indicates the filter is not loaded by qBittorrent.
+Exits with status 2 if any connected peer matches the filter.`,
+	Args: cobra.MatchAll(cobra.NoArgs, func(cmd *cobra.Command, args []string) error {
+		if flagTop < 0 {
+			return fmt.Errorf("invalid --top %d, must not be negative", flagTop)
+		}
+		return nil
+	}),
+	Run: func(cmd *cobra.Command, args []string) {
+		matcher, filterPath := loadMatcher()
+
+		targets := sync.Targets()
+		if len(targets) == 0 {
+			log.Fatalf("no qBittorrent target configured.")
+		}
+
+		unblocked := 0
+		failed := 0
+		for _, target := range targets {
+			logger := log.WithField("target", target.Name)
+
+			client, err := target.Client()
+			if err != nil {
+				logger.Warnf("%v, skipping...", err)
+				failed += 1
+				continue
+			}
+
+			if FlagFilter == "" && !target.Uses(filterPath) {
+				_, prefPath := target.Status()
+				logger.Warnf(`qBittorrent loads "%s" instead of the active slot "%s".`, prefPath, filterPath)
+			}
+
+			peers, err := connectedPeers(client)
+			if err != nil {
+				logger.Warnf("failed to list peers: %v, skipping...", err)
+				failed += 1
+				continue
+			}
+
+			hits := map[string]int{}
+			w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+			fmt.Printf("\n[%s] %d connected peers\n", target.Name, len(peers))
+			fmt.Fprintf(w, "PEER\tCLIENT\tTORRENT\tRANGE\n")
+			matched := 0
+			for _, peer := range peers {
+				interval, ok := matcher.Match(peer.Addr)
+				if !ok {
+					continue
+				}
+				hits[interval.String()] += 1
+				matched += 1
+				fmt.Fprintf(w, "%s\t%s\t%s\t%s\n", peer.Endpoint(), peer.Client, peer.Torrent.Name, interval)
+			}
+			w.Flush()
+			unblocked += matched
+
+			if matched == 0 {
+				fmt.Printf("no connected peer should have been blocked.\n")
+				continue
+			}
+
+			ranges := []string{}
+			for r := range hits {
+				ranges = append(ranges, r)
+			}
+			sort.Slice(ranges, func(i, j int) bool {
+				if hits[ranges[i]] != hits[ranges[j]] {
+					return hits[ranges[i]] > hits[ranges[j]]
+				}
+				return ranges[i] < ranges[j]
+			})
+			if len(ranges) > flagTop {
+				ranges = ranges[:flagTop]
+			}
+
+			fmt.Printf("\n%d of %d connected peers should have been blocked, most hit ranges:\n", matched, len(peers))
+			w = tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+			fmt.Fprintf(w, "RANGE\tPEERS\n")
+			for _, r := range ranges {
+				fmt.Fprintf(w, "%s\t%d\n", r, hits[r])
+			}
+			w.Flush()
+
+			_, prefPath := target.Status()
+			logger.Warnf(`%d connected peers match the filter, check that "%s" is loaded and ip filtering is enabled.`, matched, prefPath)
+		}
+
+		if failed > 0 {
+			log.Fatalf("failed to audit %d of %d qBittorrent targets.", failed, len(targets))
+		}
+		if unblocked > 0 {
+			os.Exit(2)
+		}
+	},
+}
+
+func init() {
+	AuditCmd.Flags().IntVarP(&flagTop, "top", "t", 10, "Number of most hit ranges to report. (default: 10)")
+}
@@ -0,0 +1,73 @@
+package qb
+
+import (
+	log "github.com/sirupsen/logrus"
+	"github.com/spf13/cobra"
+
+	"github.com/vizv/ipfilter/cmd/ipfilter/sync"
+)
+
+var flagDryRun bool
+
+var BanPeersCmd = &cobra.Command{
+	Use:   "ban-peers",
+	Short: "Ban connected peers matching the filter.",
+	Long:  `Ban peers currently connected to qBittorrent targets which match the filter, instead of waiting for them to reconnect.`,
+	Args:  cobra.NoArgs,
+	Run: func(cmd *cobra.Command, args []string) {
+		matcher, _ := loadMatcher()
+
+		targets := sync.Targets()
+		if len(targets) == 0 {
+			log.Fatalf("no qBittorrent target configured.")
+		}
+
+		failed := 0
+		for _, target := range targets {
+			logger := log.WithField("target", target.Name)
+
+			client, err := target.Client()
+			if err != nil {
+				logger.Warnf("%v, skipping...", err)
+				failed += 1
+				continue
+			}
+
+			peers, err := connectedPeers(client)
+			if err != nil {
+				logger.Warnf("failed to list peers: %v, skipping...", err)
+				failed += 1
+				continue
+			}
+
+			endpoints := []string{}
+			for _, peer := range peers {
+				interval, ok := matcher.Match(peer.Addr)
+				if !ok {
+					continue
+				}
+				logger.WithFields(log.Fields{"peer": peer.Endpoint(), "torrent": peer.Torrent.Name, "range": interval.String()}).Infof("peer matched")
+				endpoints = append(endpoints, peer.Endpoint())
+			}
+			logger.Infof("%d of %d connected peers matched.", len(endpoints), len(peers))
+
+			if len(endpoints) == 0 || flagDryRun {
+				continue
+			}
+			if err := client.BanPeers(endpoints); err != nil {
+				logger.Warnf("%v", err)
+				failed += 1
+				continue
+			}
+			logger.Infof("%d peers banned.", len(endpoints))
+		}
+
+		if failed > 0 {
+			log.Fatalf("failed to ban peers on %d of %d qBittorrent targets.", failed, len(targets))
+		}
+	},
+}
+
+func init() {
+	BanPeersCmd.Flags().BoolVarP(&flagDryRun, "dry-run", "n", false, "Only list matched peers without banning them. (default: false)")
+}
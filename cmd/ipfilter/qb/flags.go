@@ -0,0 +1,78 @@
+package qb
+
+import (
+	"net"
+	"net/netip"
+	"sort"
+	"strconv"
+
+	log "github.com/sirupsen/logrus"
+	"github.com/spf13/viper"
+
+	"github.com/vizv/ipfilter/cmd/ipfilter/sync"
+	"github.com/vizv/ipfilter/utils/iprange"
+	"github.com/vizv/ipfilter/utils/qb"
+)
+
+var FlagFilter string
+
+// loadMatcher loads the filter from --filter, or the active slot in sync output directory, and returns the matcher
+// with the filter path.
+func loadMatcher() (*iprange.Matcher, string) {
+	filterPath := FlagFilter
+	if filterPath == "" {
+		activePath, err := sync.ActiveSlotPath(viper.GetString("sync.output-dir"), sync.Generations())
+		if err != nil {
+			log.Fatalf("failed to find active filter: %v, specify one with --filter", err)
+		}
+		filterPath = activePath
+	}
+
+	intervals, rulesCount := sync.LoadIntervals(filterPath)
+	matcher := iprange.NewMatcher(intervals.Merge())
+	log.Infof("%d rules loaded, merged to %d rules.", rulesCount, matcher.Len())
+	return matcher, filterPath
+}
+
+// connectedPeer is a peer connected for a torrent.
+type connectedPeer struct {
+	qb.Peer
+	Addr    netip.Addr
+	Torrent qb.Torrent
+}
+
+// Endpoint returns "IP:PORT" or "[IPv6]:PORT" accepted by banPeers.
+func (p connectedPeer) Endpoint() string {
+	return net.JoinHostPort(p.Addr.String(), strconv.Itoa(p.Port))
+}
+
+// connectedPeers lists peers connected for all torrents, sorted by address.
+func connectedPeers(client *qb.Client) ([]connectedPeer, error) {
+	torrents, err := client.GetTorrents()
+	if err != nil {
+		return nil, err
+	}
+
+	peers := []connectedPeer{}
+	for _, torrent := range torrents {
+		torrentPeers, err := client.GetTorrentPeers(torrent.Hash)
+		if err != nil {
+			log.WithField("torrent", torrent.Name).Warnf("failed to get peers: %v, skipping...", err)
+			continue
+		}
+
+		for _, peer := range torrentPeers {
+			addr, err := netip.ParseAddr(peer.IP)
+			if err != nil {
+				log.WithFields(log.Fields{"torrent": torrent.Name, "ip": peer.IP}).Debugf("ignore peer with invalid address")
+				continue
+			}
+			peers = append(peers, connectedPeer{peer, addr.Unmap(), torrent})
+		}
+	}
+
+	sort.Slice(peers, func(i, j int) bool {
+		return peers[i].Addr.Less(peers[j].Addr)
+	})
+	return peers, nil
+}
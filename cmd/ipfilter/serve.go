@@ -0,0 +1,58 @@
+package ipfilter
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"os/signal"
+	"syscall"
+
+	log "github.com/sirupsen/logrus"
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+
+	"github.com/vizv/ipfilter/cmd/ipfilter/config"
+	"github.com/vizv/ipfilter/cmd/ipfilter/sync"
+)
+
+var serveOutputDir string
+
+var ServeCmd = &cobra.Command{
+	Use:   "serve",
+	Short: "Serve the active slot over HTTP.",
+	Long: `Serve the active slot of the sync output directory as /ipfilter.dat, /blocklist.p2p and /cidr.txt, so other
+"ipfilter sync" instances, qBittorrent and Transmission on the network can use it as upstream.
+
+Responses are gzip-encoded on request, with ETag and Last-Modified headers for conditional requests.
+
+The lookup API is served as well:
+  GET  /v1/check?ip=ADDRESS  check whether an address is blocked, with the matching range, sources and description
+  POST /v1/check             check a batch of addresses, with a body like {"ips": ["1.2.3.4", "2001:db8::1"]}
+  GET  /v1/stats             rule and address counts of the active slot and the sources
+  GET  /metrics              Prometheus metrics, only collected by "ipfilter sync --listen"
+  GET  /readyz               ready when a slot is active
+  GET  /healthz              always healthy, see "ipfilter sync --help" for the health checks of the sync daemon
+Use "ipfilter sync --listen" to serve from the sync daemon instead.`,
+	Args: cobra.NoArgs,
+	Run: func(cmd *cobra.Command, args []string) {
+		ctx, cancel := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+		defer cancel()
+
+		outputDir := serveOutputDir
+		if outputDir == "" {
+			outputDir = viper.GetString("sync.output-dir")
+		}
+		sources := sync.Sources(sync.ListSetting(viper.Get("sync.dat-urls")), viper.GetString("sync.cache-dir"), sync.Interval())
+		server := sync.NewServer(&sync.StaticState{OutputDir: outputDir, Generations: sync.Generations(), SourceList: sources})
+		if err := server.ListenAndServe(ctx, viper.GetString("serve.listen")); err != nil {
+			log.Fatalf("%v", err)
+		}
+	},
+}
+
+func init() {
+	ServeCmd.Flags().StringP("listen", "l", sync.DEFAULT_LISTEN, fmt.Sprintf("Address to listen at. (default: %s)", sync.DEFAULT_LISTEN))
+	config.BindFlag("serve.listen", ServeCmd.Flags().Lookup("listen"))
+
+	ServeCmd.Flags().StringVarP(&serveOutputDir, "output-dir", "o", "", "Output directory of sync to serve the active slot from, defaults to sync.output-dir in config. (default: .)")
+}
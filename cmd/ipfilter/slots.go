@@ -0,0 +1,21 @@
+package ipfilter
+
+import (
+	"github.com/spf13/cobra"
+
+	"github.com/vizv/ipfilter/cmd/ipfilter/slots"
+)
+
+var SlotsCmd = &cobra.Command{
+	Use:   "slots",
+	Short: "Manage ipfilter.dat slots.",
+	Long:  `Show generations kept in the slots of the sync output directory, or roll back to a previous generation and unpin it.`,
+}
+
+func init() {
+	SlotsCmd.PersistentFlags().StringVarP(&slots.FlagOutputDir, "output-dir", "o", "", "Output directory of sync, defaults to sync.output-dir in config. (default: .)")
+
+	SlotsCmd.AddCommand(slots.StatusCmd)
+	SlotsCmd.AddCommand(slots.NewRollbackCmd())
+	SlotsCmd.AddCommand(slots.NewUnpinCmd())
+}
@@ -0,0 +1,24 @@
+package slots
+
+import (
+	log "github.com/sirupsen/logrus"
+	"github.com/spf13/viper"
+
+	"github.com/vizv/ipfilter/cmd/ipfilter/sync"
+)
+
+var FlagOutputDir string
+
+// openSlots opens slots in the output directory from --output-dir of slots command, or sync.output-dir.
+func openSlots() *sync.Slots {
+	outputDir := FlagOutputDir
+	if outputDir == "" {
+		outputDir = viper.GetString("sync.output-dir")
+	}
+
+	slots, err := sync.OpenSlots(outputDir, sync.Generations())
+	if err != nil {
+		log.Fatalf("failed to open slots: %v", err)
+	}
+	return slots
+}
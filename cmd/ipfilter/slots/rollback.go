@@ -0,0 +1,138 @@
+package slots
+
+import (
+	log "github.com/sirupsen/logrus"
+	"github.com/spf13/cobra"
+
+	"github.com/vizv/ipfilter/cmd/ipfilter/sync"
+)
+
+// NewRollbackCmd creates the rollback command, which is available as both "slots rollback" and "sync rollback".
+func NewRollbackCmd() *cobra.Command {
+	var flagTo int
+
+	cmd := &cobra.Command{
+		Use:   "rollback",
+		Short: "Roll back to a previous generation.",
+		Long: `Activate a previous generation kept in the slots, and notify all configured qBittorrent, Transmission and
+Deluge targets.
+
+The generation is pinned, the sync daemon will not switch slots until "ipfilter sync unpin" is run.`,
+		Args: cobra.NoArgs,
+		Run: func(cmd *cobra.Command, args []string) {
+			slots := openSlots()
+
+			generations := slots.Generations()
+			to := flagTo
+			if to < 0 {
+				previous, ok := slots.Previous()
+				if !ok {
+					log.Fatalf("no previous generation to roll back to.")
+				}
+				to = previous
+			}
+			if to >= len(generations) {
+				log.Fatalf("generation %d not found, %d generations kept.", to, len(generations))
+			}
+			target := generations[to]
+			if active := slots.Active(); active != nil && active.Slot == target.Slot {
+				log.Fatalf("generation %d is already active.", to)
+			}
+
+			targetPath, err := slots.Path(target.Slot)
+			if err != nil {
+				log.Fatalf("error getting absolute path for ipfilter.dat: %v", err)
+			}
+			log.Infof(`rolling back to generation %d "%s"...`, to, targetPath)
+
+			targets := sync.Targets()
+			if succeeded, err := sync.RefreshTargets(targets, targetPath); err != nil {
+				if succeeded == 0 {
+					log.Fatalf("%v", err)
+				}
+				log.Warnf("%v", err)
+			}
+			updateBlocklistTargets(targetPath, target.Hash)
+
+			if err := slots.Activate(target.Slot); err != nil {
+				log.Fatalf("%v", err)
+			}
+			if err := slots.Pin(true); err != nil {
+				log.Fatalf("%v", err)
+			}
+			log.Infof(`slot switched to %s and pinned, run "ipfilter sync unpin" to resume switching slots.`, targetPath)
+		},
+	}
+
+	cmd.Flags().IntVarP(&flagTo, "to", "t", -1, "Generation to roll back to as listed by slots status, defaults to the one before the active generation.")
+
+	return cmd
+}
+
+// NewUnpinCmd creates the unpin command, which is available as both "slots unpin" and "sync unpin".
+func NewUnpinCmd() *cobra.Command {
+	return &cobra.Command{
+		Use:   "unpin",
+		Short: "Unpin the active generation.",
+		Long: `Unpin the generation activated by rollback, so the sync daemon switches slots again on its next cycle.
+
+Targets not loading the active generation, e.g. failed to roll back, are notified again.`,
+		Args: cobra.NoArgs,
+		Run: func(cmd *cobra.Command, args []string) {
+			slots := openSlots()
+			if !slots.Pinned() {
+				log.Infof("slot not pinned.")
+				return
+			}
+
+			if err := slots.Pin(false); err != nil {
+				log.Fatalf("%v", err)
+			}
+			log.Infof("slot unpinned.")
+
+			active := slots.Active()
+			if active == nil {
+				return
+			}
+			activePath, err := slots.Path(active.Slot)
+			if err != nil {
+				log.Fatalf("error getting absolute path for ipfilter.dat: %v", err)
+			}
+
+			outdated := []*sync.Target{}
+			for _, target := range sync.Targets() {
+				if err := target.Poll(); err == nil && target.Uses(activePath) {
+					continue
+				}
+				outdated = append(outdated, target)
+			}
+			if _, err := sync.RefreshTargets(outdated, activePath); err != nil {
+				log.Warnf("%v", err)
+			}
+			updateBlocklistTargets(activePath, active.Hash)
+		},
+	}
+}
+
+// blocklistTarget is a target loading a blocklist converted from a slot.
+type blocklistTarget interface {
+	Section() string
+	Update(activePath, activeHash string) error
+}
+
+// updateBlocklistTargets updates all Transmission and Deluge targets to the slot, failed targets are only warned.
+func updateBlocklistTargets(slotPath, slotHash string) {
+	targets := []blocklistTarget{}
+	for _, target := range sync.TransmissionTargets() {
+		targets = append(targets, target)
+	}
+	for _, target := range sync.DelugeTargets() {
+		targets = append(targets, target)
+	}
+
+	for _, target := range targets {
+		if err := target.Update(slotPath, slotHash); err != nil {
+			log.WithField("target", target.Section()).Warnf("failed to update blocklist: %v", err)
+		}
+	}
+}
@@ -0,0 +1,41 @@
+package slots
+
+import (
+	"fmt"
+	"os"
+	"text/tabwriter"
+	"time"
+
+	"github.com/spf13/cobra"
+)
+
+var StatusCmd = &cobra.Command{
+	Use:   "status",
+	Short: "Show slots status.",
+	Long:  `Show the active slot and all generations kept in the sync output directory.`,
+	Args:  cobra.NoArgs,
+	Run: func(cmd *cobra.Command, args []string) {
+		slots := openSlots()
+
+		active := slots.Active()
+		if active == nil {
+			fmt.Printf("directory: %s\nactive: (none)\n", slots.Dir())
+		} else {
+			fmt.Printf("directory: %s\nactive: %s (switched at %s)\n", slots.Dir(), active.Slot, slots.SwitchedAt().Format(time.RFC3339))
+			if slots.Pinned() {
+				fmt.Printf("pinned: run \"ipfilter sync unpin\" to resume switching slots\n")
+			}
+		}
+
+		w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+		fmt.Fprintf(w, "\nGENERATION\tSLOT\tCREATED\tHASH\t\n")
+		for i, generation := range slots.Generations() {
+			marker := ""
+			if active != nil && generation.Slot == active.Slot {
+				marker = "(active)"
+			}
+			fmt.Fprintf(w, "%d\t%s\t%s\t%s\t%s\n", i, generation.Slot, generation.CreatedAt.Format(time.RFC3339), generation.Hash, marker)
+		}
+		w.Flush()
+	},
+}
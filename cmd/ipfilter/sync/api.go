@@ -0,0 +1,291 @@
+package sync
+
+import (
+	"encoding/json"
+	"fmt"
+	"math/big"
+	"net/http"
+	"net/netip"
+	"os"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+
+	"github.com/vizv/ipfilter/utils/iprange"
+	"github.com/vizv/ipfilter/utils/parser"
+)
+
+// maxCheckBatch limits the number of addresses checked in one POST /v1/check request.
+const maxCheckBatch = 10000
+
+// maxCheckBody limits the size of POST /v1/check request bodies.
+const maxCheckBody = 1 << 20
+
+// CheckRange is the range of a rule.
+type CheckRange struct {
+	From string `json:"from"`
+	To   string `json:"to"`
+}
+
+// CheckSource is the rule of a source containing the checked address.
+type CheckSource struct {
+	URL         string     `json:"url"`
+	Range       CheckRange `json:"range"`
+	Description string     `json:"description,omitempty"`
+}
+
+// CheckResult is the result of checking an address against the active slot.
+type CheckResult struct {
+	IP          string        `json:"ip"`
+	Blocked     bool          `json:"blocked"`
+	Range       *CheckRange   `json:"range,omitempty"`
+	Sources     []CheckSource `json:"sources,omitempty"`
+	Description string        `json:"description,omitempty"`
+	Error       string        `json:"error,omitempty"`
+}
+
+// CheckRequest is the body of POST /v1/check.
+type CheckRequest struct {
+	IPs []string `json:"ips"`
+}
+
+// CheckResponse is the body of the POST /v1/check response.
+type CheckResponse struct {
+	Results []CheckResult `json:"results"`
+}
+
+// SourceStats is the rules count of a downloaded source.
+type SourceStats struct {
+	URL   string `json:"url"`
+	Rules int    `json:"rules"`
+}
+
+// Stats is the body of the GET /v1/stats response. Address counts may exceed 64 bits for IPv6.
+type Stats struct {
+	ActiveSlot    string        `json:"active_slot"`
+	ActiveHash    string        `json:"active_hash"`
+	SwitchedAt    *time.Time    `json:"switched_at,omitempty"`
+	Rules         int           `json:"rules"`
+	RulesIPv4     int           `json:"rules_ipv4"`
+	RulesIPv6     int           `json:"rules_ipv6"`
+	AddressesIPv4 *big.Int      `json:"addresses_ipv4"`
+	AddressesIPv6 *big.Int      `json:"addresses_ipv6"`
+	Sources       []SourceStats `json:"sources"`
+}
+
+// sourceIndex is the rules index of a source cache file, rebuilt when the file changes.
+type sourceIndex struct {
+	modTime time.Time
+	size    int64
+	index   *iprange.Index
+}
+
+// activeRules is the active slot with its merged intervals.
+type activeRules struct {
+	slots     *Slots
+	active    *Generation
+	intervals iprange.Intervals
+	matcher   *iprange.Matcher
+}
+
+func (s *Server) handleCheck(w http.ResponseWriter, r *http.Request) {
+	rawIP := r.URL.Query().Get("ip")
+	addr, err := netip.ParseAddr(rawIP)
+	if err != nil {
+		writeJSONError(w, http.StatusBadRequest, fmt.Sprintf("invalid IP: %q", rawIP))
+		return
+	}
+
+	rules, status, err := s.activeRules()
+	if err != nil {
+		writeJSONError(w, status, err.Error())
+		return
+	}
+
+	writeJSON(w, http.StatusOK, s.check(rules, s.sourceIndexes(), addr))
+}
+
+func (s *Server) handleCheckBatch(w http.ResponseWriter, r *http.Request) {
+	request := CheckRequest{}
+	if err := json.NewDecoder(http.MaxBytesReader(w, r.Body, maxCheckBody)).Decode(&request); err != nil {
+		writeJSONError(w, http.StatusBadRequest, fmt.Sprintf("invalid request: %v", err))
+		return
+	}
+	if len(request.IPs) > maxCheckBatch {
+		writeJSONError(w, http.StatusRequestEntityTooLarge, fmt.Sprintf("too many IPs, at most %d per request", maxCheckBatch))
+		return
+	}
+
+	rules, status, err := s.activeRules()
+	if err != nil {
+		writeJSONError(w, status, err.Error())
+		return
+	}
+
+	indexes := s.sourceIndexes()
+	response := CheckResponse{Results: make([]CheckResult, 0, len(request.IPs))}
+	for _, rawIP := range request.IPs {
+		addr, err := netip.ParseAddr(rawIP)
+		if err != nil {
+			response.Results = append(response.Results, CheckResult{IP: rawIP, Error: "invalid IP"})
+			continue
+		}
+		response.Results = append(response.Results, s.check(rules, indexes, addr))
+	}
+	writeJSON(w, http.StatusOK, response)
+}
+
+func (s *Server) handleStats(w http.ResponseWriter, r *http.Request) {
+	rules, status, err := s.activeRules()
+	if err != nil {
+		writeJSONError(w, status, err.Error())
+		return
+	}
+
+	stats := Stats{
+		ActiveSlot:    rules.active.Slot,
+		ActiveHash:    rules.active.Hash,
+		Rules:         rules.matcher.Len(),
+		AddressesIPv4: big.NewInt(0),
+		AddressesIPv6: big.NewInt(0),
+		Sources:       []SourceStats{},
+	}
+	if switchedAt := rules.slots.SwitchedAt(); !switchedAt.IsZero() {
+		stats.SwitchedAt = &switchedAt
+	}
+	for _, interval := range rules.intervals {
+		if interval.From.Is4() {
+			stats.RulesIPv4 += 1
+			stats.AddressesIPv4.Add(stats.AddressesIPv4, interval.Size())
+		} else {
+			stats.RulesIPv6 += 1
+			stats.AddressesIPv6.Add(stats.AddressesIPv6, interval.Size())
+		}
+	}
+
+	indexes := s.sourceIndexes()
+	for _, source := range s.state.Sources() {
+		if index, ok := indexes[source.URL]; ok {
+			stats.Sources = append(stats.Sources, SourceStats{URL: source.Redacted(), Rules: index.Len()})
+		}
+	}
+	writeJSON(w, http.StatusOK, stats)
+}
+
+// check matches the address against the active slot, and the sources containing it.
+func (s *Server) check(rules *activeRules, indexes map[string]*iprange.Index, addr netip.Addr) CheckResult {
+	result := CheckResult{IP: addr.String()}
+	interval, ok := rules.matcher.Match(addr)
+	if !ok {
+		return result
+	}
+
+	result.Blocked = true
+	result.Range = &CheckRange{interval.From.String(), interval.To.String()}
+	for _, source := range s.state.Sources() {
+		index, ok := indexes[source.URL]
+		if !ok {
+			continue
+		}
+		rule, ok := index.Match(addr)
+		if !ok {
+			continue
+		}
+
+		result.Sources = append(result.Sources, CheckSource{
+			URL:         source.Redacted(),
+			Range:       CheckRange{rule.From.String(), rule.To.String()},
+			Description: rule.Description,
+		})
+		if result.Description == "" {
+			result.Description = rule.Description
+		}
+	}
+	return result
+}
+
+// activeRules returns the rules of the active slot, and the HTTP status if it is unavailable.
+func (s *Server) activeRules() (*activeRules, int, error) {
+	slots, err := s.state.Slots()
+	if err != nil {
+		return nil, http.StatusInternalServerError, fmt.Errorf("failed to open slots: %v", err)
+	}
+	active := slots.Active()
+	if active == nil {
+		return nil, http.StatusServiceUnavailable, fmt.Errorf("no active slot")
+	}
+	slotPath, err := slots.Path(active.Slot)
+	if err != nil {
+		return nil, http.StatusInternalServerError, err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.switchHash(active.Hash)
+	intervals := s.loadIntervals(slotPath)
+	if s.matcher == nil {
+		s.matcher = iprange.NewMatcher(intervals)
+	}
+	return &activeRules{slots, active, intervals, s.matcher}, http.StatusOK, nil
+}
+
+// sourceIndexes returns the rules index of every downloaded source by URL, indexed again when its cache file changes.
+func (s *Server) sourceIndexes() map[string]*iprange.Index {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	indexes := map[string]*iprange.Index{}
+	seen := map[string]bool{}
+	for _, source := range s.state.Sources() {
+		seen[source.CachePath] = true
+		info, err := os.Stat(source.CachePath)
+		if err != nil {
+			continue
+		}
+
+		cached, ok := s.indexes[source.CachePath]
+		if !ok || !cached.modTime.Equal(info.ModTime()) || cached.size != info.Size() {
+			cached = &sourceIndex{info.ModTime(), info.Size(), loadIndex(source.CachePath)}
+			s.indexes[source.CachePath] = cached
+		}
+		indexes[source.URL] = cached.index
+	}
+
+	for cachePath := range s.indexes {
+		if !seen[cachePath] {
+			delete(s.indexes, cachePath)
+		}
+	}
+	return indexes
+}
+
+// loadIndex indexes the rules of an ipfilter.dat file with their descriptions.
+func loadIndex(file string) *iprange.Index {
+	log.Debugf(`indexing rules from "%s"...`, file)
+	rules := []iprange.Rule{}
+	for rule := range parser.ParseIPFilterDatRules(file) {
+		from, err := iprange.ParseIP(rule.From)
+		if err != nil {
+			continue
+		}
+		to, err := iprange.ParseIP(rule.To)
+		if err != nil {
+			continue
+		}
+		rules = append(rules, iprange.Rule{Interval: iprange.Interval{From: from, To: to}, Description: rule.Description})
+	}
+	return iprange.NewIndex(rules)
+}
+
+func writeJSON(w http.ResponseWriter, status int, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	if err := json.NewEncoder(w).Encode(v); err != nil {
+		log.Debugf("failed to write response: %v", err)
+	}
+}
+
+func writeJSONError(w http.ResponseWriter, status int, message string) {
+	writeJSON(w, status, map[string]string{"error": message})
+}
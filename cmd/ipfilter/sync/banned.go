@@ -0,0 +1,140 @@
+package sync
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path"
+
+	log "github.com/sirupsen/logrus"
+
+	"github.com/vizv/ipfilter/utils/files"
+	"github.com/vizv/ipfilter/utils/hash"
+	"github.com/vizv/ipfilter/utils/iprange"
+	"github.com/vizv/ipfilter/utils/logging"
+)
+
+// ExpandIntervals lists every address in the intervals, failing if there are more than max addresses.
+func ExpandIntervals(intervals iprange.Intervals, max int) ([]string, error) {
+	ips := []string{}
+	for _, interval := range intervals {
+		interval = interval.Fix()
+		if interval.From.Is4() != interval.To.Is4() {
+			continue
+		}
+
+		for addr := interval.From.Addr; addr.IsValid() && addr.Compare(interval.To.Addr) <= 0; addr = addr.Next() {
+			if len(ips) >= max {
+				return nil, fmt.Errorf("more than %d addresses, too many for banned IPs", max)
+			}
+			ips = append(ips, addr.String())
+		}
+	}
+	return ips, nil
+}
+
+// bannedIPsStateFile keeps the addresses pushed to each target, so only those are replaced by the next push.
+const bannedIPsStateFile = "ipfilter-banned-ips.json"
+
+// pushBannedIPs replaces addresses previously pushed to banned_IPs of all targets with addresses in the merged rules.
+// Addresses banned manually in qBittorrent are kept, and the file filter is untouched.
+func (d *Daemon) pushBannedIPs(intervals iprange.Intervals, mergedBytes []byte) error {
+	mergedHash := hash.CalculateMD5(mergedBytes)
+	if mergedHash == d.bannedIPsHash {
+		log.Infof("banned IPs unchanged, pushing cancelled.")
+		return nil
+	}
+
+	ips, err := ExpandIntervals(intervals, MaxBannedIPs)
+	if err != nil {
+		return fmt.Errorf("failed to expand rules: %v", err)
+	}
+
+	statePath := path.Join(d.cacheDir, bannedIPsStateFile)
+	pushed := loadPushedIPs(statePath)
+
+	log.Infof("pushing %d banned IPs to %d qBittorrent targets...", len(ips), len(d.targets))
+	failed := 0
+	for _, target := range d.targets {
+		targetPushed, err := pushTargetBannedIPs(target, ips, pushed[target.Section()])
+		metricQBittorrentNotify.Inc(target.Section(), resultLabel(err))
+		if err != nil {
+			target.logger().Warnf("failed to push banned IPs: %v", err)
+			failed += 1
+			continue
+		}
+		pushed[target.Section()] = targetPushed
+		target.logger().Infof("%d banned IPs pushed, %d already banned manually.", len(targetPushed), len(ips)-len(targetPushed))
+	}
+	if err := savePushedIPs(statePath, pushed); err != nil {
+		log.WithField(logging.FieldCache, statePath).Warnf("failed to save pushed banned IPs: %v", err)
+	}
+	if failed > 0 {
+		return fmt.Errorf("failed to push banned IPs to %d of %d qBittorrent targets", failed, len(d.targets))
+	}
+
+	d.bannedIPsHash = mergedHash
+	return nil
+}
+
+// pushTargetBannedIPs replaces the addresses previously pushed to the target with the addresses, and keeps addresses
+// banned manually. It returns the addresses pushed, without those already banned manually.
+func pushTargetBannedIPs(target *Target, ips []string, previous []string) ([]string, error) {
+	client, err := target.Client()
+	if err != nil {
+		return nil, err
+	}
+	prefs, err := client.GetPreferences()
+	if err != nil {
+		return nil, err
+	}
+
+	wasPushed := map[string]bool{}
+	for _, ip := range previous {
+		wasPushed[ip] = true
+	}
+	banned := []string{}
+	manual := map[string]bool{}
+	for _, ip := range prefs.BannedIPList() {
+		if !wasPushed[ip] && !manual[ip] {
+			banned = append(banned, ip)
+			manual[ip] = true
+		}
+	}
+
+	pushed := []string{}
+	for _, ip := range ips {
+		if !manual[ip] {
+			pushed = append(pushed, ip)
+		}
+	}
+	if err := client.SetBannedIPs(append(banned, pushed...)); err != nil {
+		return nil, err
+	}
+	return pushed, nil
+}
+
+// loadPushedIPs reads the addresses pushed to each target by section, or nothing if never pushed.
+func loadPushedIPs(statePath string) map[string][]string {
+	pushed := map[string][]string{}
+	stateBytes, err := os.ReadFile(statePath)
+	if err != nil {
+		return pushed
+	}
+	if err := json.Unmarshal(stateBytes, &pushed); err != nil {
+		log.WithField(logging.FieldCache, statePath).Warnf("failed to parse pushed banned IPs: %v, treating all banned IPs as manual", err)
+		return map[string][]string{}
+	}
+	return pushed
+}
+
+func savePushedIPs(statePath string, pushed map[string][]string) error {
+	stateBytes, err := json.MarshalIndent(pushed, "", "  ")
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(path.Dir(statePath), 0o755); err != nil {
+		return err
+	}
+	return files.WriteFileAtomic(statePath, stateBytes, 0o644)
+}
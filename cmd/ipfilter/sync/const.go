@@ -2,3 +2,30 @@ package sync
 
 const DEFAULT_IPFILTER_DAT_FILE_URL = "https://ipfilter.viz.network/ipfilter.dat"
 const DEFAULT_UPDATE_INTERVAL = "15m"
+const DEFAULT_GENERATIONS = 2
+const DEFAULT_USERNAME = "admin"
+
+const (
+	// ModeFilter saves merged rules to slots and sets ip_filter_path of qBittorrent.
+	ModeFilter = "filter"
+	// ModeBannedIPs pushes merged rules as individual addresses to banned_IPs of qBittorrent.
+	ModeBannedIPs = "banned-ips"
+)
+
+// MaxBannedIPs limits addresses pushed to banned_IPs, which is meant for small curated lists.
+const MaxBannedIPs = 65536
+
+const DEFAULT_TRANSMISSION_RPC_PATH = "/transmission/rpc"
+
+// DEFAULT_NOTIFY_TIMEOUT is the timeout of webhooks and exec hooks.
+const DEFAULT_NOTIFY_TIMEOUT = "30s"
+
+// DEFAULT_MAX_AGE is the age of the active filter or of the rules of a source after which the daemon is unhealthy,
+// "0" to disable.
+const DEFAULT_MAX_AGE = "0"
+
+// DEFAULT_MAX_FAILURES is the number of consecutive failed cycles after which the daemon is unhealthy, 0 to disable.
+const DEFAULT_MAX_FAILURES = 3
+
+// DEFAULT_LISTEN is the address "ipfilter serve" listens at.
+const DEFAULT_LISTEN = ":8090"
@@ -0,0 +1,670 @@
+package sync
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"path"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+	"github.com/spf13/viper"
+
+	"github.com/vizv/ipfilter/utils/files"
+	"github.com/vizv/ipfilter/utils/format"
+	"github.com/vizv/ipfilter/utils/hash"
+	"github.com/vizv/ipfilter/utils/iprange"
+	"github.com/vizv/ipfilter/utils/logging"
+)
+
+// Daemon downloads sources on their schedules, merges them and activates the merged ipfilter.dat.
+type Daemon struct {
+	args []string
+
+	updateSchedule Schedule
+	runOnce        bool
+	cacheDir       string
+	outputDir      string
+	generations    int
+	scheduler      *Scheduler
+	mode           string
+	maxAge         time.Duration
+	maxFailures    int
+	targets        []*Target
+	notifiers      []Notifier
+
+	// mu guards the settings above and the state below, which are also read from the signal and API goroutines
+	mu        sync.Mutex
+	lastRun   time.Time
+	lastError error
+	isRetry   bool
+	pending   bool
+
+	// health state, see health.go
+	activated    bool
+	lastVerified time.Time
+	failedCycles int
+	cycleError   error
+
+	bannedIPsHash string
+
+	// ValidateConfig validates the config file before reloading it, invalid config files are rejected.
+	ValidateConfig func(configFile string) error
+	configChanged  atomic.Bool
+}
+
+// NewDaemon creates a daemon from current settings, args are the filter.dat URLs from the command line.
+func NewDaemon(args []string) *Daemon {
+	d := &Daemon{args: args}
+	d.load(false)
+	return d
+}
+
+// load reads all settings, and keeps the state of unchanged sources if keepSources is set.
+func (d *Daemon) load(keepSources bool) {
+	updateSchedule := Interval()
+	runOnce := updateSchedule.Next(time.Now()).IsZero()
+	log.Debugf("updateSchedule: %s", updateSchedule)
+	log.Debugf("runOnce: %+v", runOnce)
+
+	cacheDir := viper.GetString("sync.cache-dir")
+	outputDir := viper.GetString("sync.output-dir")
+	log.Debugf("cacheDir: %+v", cacheDir)
+	log.Debugf("outputDir: %+v", outputDir)
+
+	rawDATURLs := d.args
+	if len(rawDATURLs) == 0 {
+		rawDATURLs = ListSetting(viper.Get("sync.dat-urls"))
+	}
+	sources := Sources(rawDATURLs, cacheDir, updateSchedule)
+	if len(sources) == 0 {
+		sources = Sources([]string{DEFAULT_IPFILTER_DAT_FILE_URL}, cacheDir, updateSchedule)
+	}
+	for _, source := range sources {
+		log.WithFields(log.Fields{logging.FieldURL: source.Redacted(), logging.FieldCache: source.CachePath}).Debugf("source schedule: %s", source.Schedule)
+	}
+
+	generations := Generations()
+	log.Debugf("generations: %+v", generations)
+
+	mode := Mode()
+	log.Debugf("mode: %s", mode)
+
+	maxAge, maxFailures := MaxAge(), MaxFailures()
+	log.Debugf("maxAge: %s", maxAge)
+	log.Debugf("maxFailures: %d", maxFailures)
+
+	targets := Targets()
+	ConnectTargets(targets)
+	notifiers := Notifiers(targets)
+	for _, notifier := range notifiers {
+		log.Debugf("notifier: %s", notifier.Section())
+	}
+
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if keepSources && d.scheduler != nil {
+		d.scheduler.Keep(sources)
+	}
+	if d.scheduler != nil {
+		configured := map[string]bool{}
+		for _, source := range sources {
+			configured[source.URL] = true
+		}
+		for _, source := range d.scheduler.Sources {
+			if !configured[source.URL] {
+				forgetSource(source)
+			}
+		}
+	}
+	d.updateSchedule = updateSchedule
+	d.runOnce = runOnce
+	d.cacheDir = cacheDir
+	d.outputDir = outputDir
+	d.generations = generations
+	d.scheduler = &Scheduler{Sources: sources}
+	d.mode = mode
+	d.maxAge = maxAge
+	d.maxFailures = maxFailures
+	d.targets = targets
+	d.notifiers = notifiers
+}
+
+// Reload re-reads the config file and reloads all settings, and returns false if the config file is rejected.
+func (d *Daemon) Reload() bool {
+	log.Infof("reloading config...")
+	d.configChanged.Store(false)
+	if !d.readConfig() {
+		return false
+	}
+	d.load(false)
+	return true
+}
+
+// reloadChanged reloads the changed config file, and keeps the schedule of unchanged sources.
+func (d *Daemon) reloadChanged() bool {
+	if !d.configChanged.Swap(false) {
+		return false
+	}
+
+	log.Infof("config file changed, reloading config...")
+	if !d.readConfig() {
+		return false
+	}
+	d.load(true)
+	return true
+}
+
+// readConfig validates and re-reads the config file, keeping the current settings if it is invalid.
+func (d *Daemon) readConfig() bool {
+	configFile := viper.ConfigFileUsed()
+	if configFile == "" {
+		log.Debugf("no config file, using current settings")
+		return true
+	}
+
+	if d.ValidateConfig != nil {
+		if err := d.ValidateConfig(configFile); err != nil {
+			problems := []error{err}
+			if joined, ok := err.(interface{ Unwrap() []error }); ok {
+				problems = joined.Unwrap()
+			}
+			for _, problem := range problems {
+				log.WithField(logging.FieldFile, configFile).Errorf("invalid config: %v", problem)
+			}
+			log.Errorf("config rejected, using current settings.")
+			return false
+		}
+	}
+
+	if err := viper.ReadInConfig(); err != nil {
+		log.Errorf("failed to reload config, using current settings: %+v", err)
+		return false
+	}
+	return true
+}
+
+// Run synchronizes until the context is cancelled, or after the first cycle if run once.
+// A reload request reloads settings and triggers an immediate synchronization.
+func (d *Daemon) Run(ctx context.Context, reload <-chan struct{}) {
+	firstPass := true
+	for {
+		if !firstPass {
+			if d.runOnce {
+				return
+			}
+
+			d.mu.Lock()
+			next, ok := d.scheduler.Next()
+			isRetry := d.isRetry
+			d.mu.Unlock()
+			if isRetry {
+				if retryAt := d.updateSchedule.Next(time.Now()); !retryAt.IsZero() && (!ok || retryAt.Before(next)) {
+					next, ok = retryAt, true
+				}
+			}
+
+			if ok {
+				if isRetry {
+					log.Warnf("retry at %s...", next.Format(time.RFC3339))
+				} else {
+					log.Infof("next synchronization scheduled at %s.", next.Format(time.RFC3339))
+				}
+			} else {
+				log.Infof("no source scheduled, waiting for reload...")
+			}
+
+			switch wait(ctx, reload, next, ok) {
+			case waitCancelled:
+				log.Infof("synchronization stopped.")
+				return
+			case waitReload:
+				d.Reload()
+				firstPass = true
+			case waitElapsed:
+				// apply changes of the config file at the start of the cycle
+				firstPass = d.reloadChanged()
+			}
+		}
+
+		if err := d.cycle(ctx, firstPass); err != nil {
+			if errors.Is(err, context.Canceled) {
+				log.Infof("synchronization aborted.")
+				return
+			}
+			log.Warnf("%v", err)
+		}
+		firstPass = false
+	}
+}
+
+type waitResult int
+
+const (
+	waitElapsed waitResult = iota
+	waitCancelled
+	waitReload
+)
+
+// wait blocks until the given time, the context is cancelled or a reload is requested.
+// It waits without deadline if hasDeadline is false.
+func wait(ctx context.Context, reload <-chan struct{}, deadline time.Time, hasDeadline bool) waitResult {
+	var elapsed <-chan time.Time
+	if hasDeadline {
+		timer := time.NewTimer(time.Until(deadline))
+		defer timer.Stop()
+		elapsed = timer.C
+	}
+
+	select {
+	case <-ctx.Done():
+		return waitCancelled
+	case <-reload:
+		return waitReload
+	case <-elapsed:
+		return waitElapsed
+	}
+}
+
+func (d *Daemon) cycle(ctx context.Context, force bool) error {
+	now := time.Now()
+	d.mu.Lock()
+	due := d.scheduler.Due(now)
+	d.lastRun = now
+	isRetry, pending := d.isRetry, d.pending
+	d.mu.Unlock()
+
+	downloadedCount, updatedCount := 0, 0
+	if len(due) > 0 {
+		log.Infof(`downloading ipfilter.dat files to "%s"...`, d.cacheDir)
+		downloadedCount, updatedCount = d.downloadSources(ctx, due, now)
+		log.Infof("%d ipfilter.dat files downloaded from %d URLs, %d files updated.", downloadedCount, len(due), updatedCount)
+	}
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	event := &Event{
+		Time:       now,
+		Mode:       d.mode,
+		Sources:    len(d.scheduler.Sources),
+		Downloaded: downloadedCount,
+		Updated:    updatedCount,
+	}
+	downloadErr := downloadsFailed(len(due), downloadedCount)
+
+	if !force && !isRetry && !pending && updatedCount == 0 {
+		log.Infof("no source updated, merging skipped.")
+		if downloadErr != nil {
+			d.notify(ctx, event, downloadErr)
+		}
+		d.recordCycle(now, len(due), downloadedCount, nil, false)
+		return nil
+	}
+
+	err := d.mergeAndActivate(event)
+	// the event fails when all downloads failed, the same as the cycle recorded
+	cycleErr := err
+	if cycleErr == nil {
+		cycleErr = downloadErr
+	}
+	if notifyErr := d.notify(ctx, event, cycleErr); err == nil {
+		err = notifyErr
+	}
+
+	d.mu.Lock()
+	d.isRetry = err != nil
+	d.lastError = err
+	d.mu.Unlock()
+	d.recordCycle(now, len(due), downloadedCount, err, event.ActiveHash != "")
+
+	return err
+}
+
+func (d *Daemon) downloadSources(ctx context.Context, sources []*Source, now time.Time) (int, int) {
+	downloadedCount := 0
+	updatedCount := 0
+	for _, source := range sources {
+		updated, err := d.downloadSource(ctx, source)
+
+		d.mu.Lock()
+		source.Reschedule(now)
+		source.LastError = err
+		if err == nil {
+			source.LastSuccess = now
+			metricSourceLastSuccess.Set(float64(now.Unix()), source.Redacted())
+			downloadedCount += 1
+		}
+		if updated {
+			source.LastUpdate = now
+			metricSourceLastUpdate.Set(float64(now.Unix()), source.Redacted())
+			updatedCount += 1
+		}
+		d.mu.Unlock()
+	}
+
+	return downloadedCount, updatedCount
+}
+
+func (d *Daemon) downloadSource(ctx context.Context, source *Source) (bool, error) {
+	cachePath := source.CachePath
+	logFields := log.Fields{logging.FieldURL: source.Redacted(), logging.FieldCache: cachePath}
+
+	log.WithFields(logFields).Infof(`downloading "%s" to "%s"...`, source.Redacted(), cachePath)
+	started := time.Now()
+	datBytes, err := Download(ctx, source.URL)
+	observeDownload(source, started, len(datBytes), err)
+	if err != nil {
+		log.WithFields(logFields).Warnf("failed to download: %v, skipping...", err)
+		return false, err
+	}
+
+	cacheBytes, err := os.ReadFile(cachePath)
+	if err == nil && bytes.Equal(datBytes, cacheBytes) {
+		return false, nil
+	}
+
+	if err := os.MkdirAll(d.cacheDir, 0o755); err != nil {
+		log.WithFields(logFields).Warnf("failed to create cache directory: %v, skipping...", err)
+		return false, fmt.Errorf("failed to create cache directory: %v", err)
+	}
+
+	if err := files.WriteFileAtomic(cachePath, datBytes, 0o644); err != nil {
+		log.WithFields(logFields).Warnf("failed to save: %v, skipping...", err)
+		return false, err
+	}
+
+	return true, nil
+}
+
+// notify sends the event to all notifiers, and returns an error if any notifier failed on a successful event.
+func (d *Daemon) notify(ctx context.Context, event *Event, err error) error {
+	event.Status = EventSuccess
+	if err != nil {
+		event.Status = EventFailure
+		event.Error = err.Error()
+	}
+
+	failed := []string{}
+	for _, notifier := range d.notifiers {
+		err := notifier.Notify(ctx, event)
+		metricNotifications.Inc(notifier.Section(), resultLabel(err))
+		if err != nil {
+			log.WithField("notifier", notifier.Section()).Warnf("failed to notify: %v", err)
+			failed = append(failed, notifier.Section())
+		}
+	}
+
+	if len(failed) > 0 && event.Status == EventSuccess {
+		return fmt.Errorf("failed to notify %d of %d notifiers: %s", len(failed), len(d.notifiers), strings.Join(failed, ", "))
+	}
+	return nil
+}
+
+func (d *Daemon) mergeAndActivate(event *Event) error {
+	if !d.anyCached() {
+		return fmt.Errorf("no source cached, merging skipped")
+	}
+
+	log.Infof("collecting rules...")
+	intervals, rulesCount := iprange.Intervals{}, 0
+	for _, source := range d.scheduler.Sources {
+		sourceIntervals, sourceCount := LoadIntervals(source.CachePath)
+		metricSourceRules.Set(float64(sourceCount), source.Redacted())
+		log.WithFields(log.Fields{logging.FieldURL: source.Redacted(), logging.FieldCache: source.CachePath, logging.FieldRules: sourceCount}).Debugf("%d rules collected from source.", sourceCount)
+		intervals = append(intervals, sourceIntervals...)
+		rulesCount += sourceCount
+	}
+	log.WithField(logging.FieldRules, rulesCount).Infof("%d rules collected.", rulesCount)
+
+	log.Infof("merging rules...")
+	intervals = intervals.Merge()
+	mergedCount := len(intervals)
+	log.WithField(logging.FieldRules, mergedCount).Infof("merged to %d rules.", mergedCount)
+	event.Rules, event.MergedRules = rulesCount, mergedCount
+	observeMerged(rulesCount, intervals)
+
+	mergedCachePath := path.Join(d.cacheDir, "ipfilter-merged.dat")
+	previousIntervals := iprange.Intervals{}
+	if _, err := os.Stat(mergedCachePath); err == nil {
+		previousIntervals, _ = LoadIntervals(mergedCachePath)
+	}
+	event.Diff = DiffIntervals(previousIntervals, intervals)
+	log.Infof("%d rules added, %d rules removed since last merge.", event.Diff.Added, event.Diff.Removed)
+
+	log.WithField(logging.FieldCache, mergedCachePath).Infof(`saving rules to "%s"...`, mergedCachePath)
+	mergedBuffer := bytes.Buffer{}
+	if err := format.WriteDat(&mergedBuffer, intervals); err != nil {
+		return fmt.Errorf("failed to write merged ipfilter.dat: %+v", err)
+	}
+	mergedBytes := mergedBuffer.Bytes()
+	if err := files.WriteFileAtomic(mergedCachePath, mergedBytes, 0o644); err != nil {
+		return fmt.Errorf("failed to write merged ipfilter.dat: %+v", err)
+	}
+	log.WithFields(log.Fields{logging.FieldCache: mergedCachePath, logging.FieldRules: mergedCount}).Infof(`merged rules saved to "%s".`, mergedCachePath)
+
+	if d.mode == ModeBannedIPs {
+		previousHash := d.bannedIPsHash
+		err := d.pushBannedIPs(intervals, mergedBytes)
+		event.ActiveHash = d.bannedIPsHash
+		event.Changed = d.bannedIPsHash != previousHash
+		return err
+	}
+
+	previous, _ := d.activeSlot()
+	err := d.switchSlots(mergedBytes)
+	if active, activePath := d.activeSlot(); active != nil {
+		event.ActivePath, event.ActiveSlot, event.ActiveHash = activePath, active.Slot, active.Hash
+		event.Changed = previous == nil || previous.Hash != active.Hash
+	}
+	return err
+}
+
+// anyCached returns whether any source has been saved to the cache directory.
+func (d *Daemon) anyCached() bool {
+	for _, source := range d.scheduler.Sources {
+		if _, err := os.Stat(source.CachePath); err == nil {
+			return true
+		}
+	}
+	return false
+}
+
+// Slots opens the slots in the output directory of current settings.
+func (d *Daemon) Slots() (*Slots, error) {
+	d.mu.Lock()
+	outputDir, generations := d.outputDir, d.generations
+	d.mu.Unlock()
+
+	return OpenSlots(outputDir, generations)
+}
+
+// Sources returns the sources of current settings.
+func (d *Daemon) Sources() []*Source {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	return d.scheduler.Sources
+}
+
+// activeSlot returns the active generation and its absolute path, or nil if no slot is active.
+func (d *Daemon) activeSlot() (*Generation, string) {
+	slots, err := OpenSlots(d.outputDir, d.generations)
+	if err != nil {
+		return nil, ""
+	}
+	active := slots.Active()
+	if active == nil {
+		return nil, ""
+	}
+	activePath, err := slots.Path(active.Slot)
+	if err != nil {
+		return nil, ""
+	}
+	return active, activePath
+}
+
+func (d *Daemon) switchSlots(mergedBytes []byte) error {
+	log.Infof("switching slots...")
+	slots, err := OpenSlots(d.outputDir, d.generations)
+	if err != nil {
+		return fmt.Errorf("failed to open slots: %v", err)
+	}
+
+	if slots.Recovered() {
+		d.recoverActiveSlot(slots)
+	}
+
+	active := slots.Active()
+	activePath := ""
+	if active != nil {
+		if activePath, err = slots.Path(active.Slot); err != nil {
+			return fmt.Errorf("error getting absolute path for current ipfilter.dat: %v", err)
+		}
+	}
+	if slots.Pinned() && active != nil {
+		d.setPending(true)
+		log.WithField(logging.FieldSlot, active.Slot).Warnf(`slot pinned, switching slots skipped until "ipfilter sync unpin" is run.`)
+		return nil
+	}
+	d.setPending(false)
+
+	if active != nil && active.Hash == hash.CalculateMD5(mergedBytes) {
+		// qBittorrent targets not loading the active slot are switched when notified
+		log.WithField(logging.FieldSlot, active.Slot).Infof("ipfilter.dat unchanged, switching slots cancelled.")
+		return nil
+	}
+
+	// never overwrite the slot any reachable qBittorrent currently loads, even if the state file disagrees. Unreachable
+	// targets are ignored, so they don't block switching the others, and are switched when notified later.
+	reachable := []*Target{}
+	for _, target := range d.targets {
+		if err := target.Poll(); err != nil {
+			target.logger().Warnf("%v, ignoring its slot in use.", err)
+			continue
+		}
+		reachable = append(reachable, target)
+	}
+	exclude := []string{}
+	for i := 0; i < d.generations; i++ {
+		slotPath, err := slots.Path(SlotFile(i))
+		if err != nil {
+			continue
+		}
+		for _, target := range reachable {
+			if target.Uses(slotPath) {
+				exclude = append(exclude, SlotFile(i))
+			}
+		}
+	}
+	outputFilename := slots.Next(exclude...)
+	if outputFilename == "" {
+		return fmt.Errorf("no slot available to save ipfilter.dat")
+	}
+	outputPath, err := slots.Path(outputFilename)
+	if err != nil {
+		return fmt.Errorf("error getting absolute path for ipfilter.dat to be saved: %v", err)
+	}
+	currentPath := activePath
+	if currentPath == "" {
+		currentPath = "(none)"
+	}
+	log.WithField(logging.FieldSlot, outputFilename).Infof(`switching "%s" to "%s"...`, currentPath, outputPath)
+
+	if err := slots.Write(outputFilename, mergedBytes); err != nil {
+		return fmt.Errorf("failed to save ipfilter.dat: %+v", err)
+	}
+
+	succeeded, refreshErr := RefreshTargets(d.targets, outputPath)
+	if len(d.targets) > 0 && succeeded == 0 {
+		return refreshErr
+	}
+
+	if err := slots.Activate(outputFilename); err != nil {
+		return err
+	}
+	metricSlotSwitches.Inc()
+	log.WithField(logging.FieldSlot, outputFilename).Infof("slot switched to %s on %d of %d qBittorrent targets.", outputPath, succeeded, len(d.targets))
+
+	return refreshErr
+}
+
+// recoverActiveSlot activates the slot loaded by qBittorrent, when the active slot is guessed without a state file.
+// setPending records whether switching slots is pending until the slot is unpinned.
+func (d *Daemon) setPending(pending bool) {
+	d.mu.Lock()
+	d.pending = pending
+	d.mu.Unlock()
+}
+
+func (d *Daemon) recoverActiveSlot(slots *Slots) {
+	for _, target := range d.targets {
+		currentPath := target.HostPath()
+		if currentPath == "" {
+			continue
+		}
+
+		for i := 0; i < d.generations; i++ {
+			slotPath, err := slots.Path(SlotFile(i))
+			if err != nil || !SamePath(slotPath, currentPath) {
+				continue
+			}
+
+			log.WithFields(log.Fields{"target": target.Name, logging.FieldSlot: SlotFile(i)}).Infof("active slot recovered from qBittorrent preferences.")
+			if err := slots.Activate(SlotFile(i)); err != nil {
+				log.Warnf("%v", err)
+			}
+			return
+		}
+	}
+}
+
+// LogStatus dumps the last run and the state of every source to the log.
+func (d *Daemon) LogStatus() {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	lastError := "none"
+	if d.lastError != nil {
+		lastError = d.lastError.Error()
+	}
+	log.WithFields(log.Fields{"lastRun": formatStatusTime(d.lastRun), "retry": d.isRetry, "lastError": lastError}).Infof("status: %d sources", len(d.scheduler.Sources))
+
+	for _, source := range d.scheduler.Sources {
+		fields := log.Fields{
+			logging.FieldURL:   source.Redacted(),
+			logging.FieldCache: source.CachePath,
+			"schedule":         source.Schedule.String(),
+			"lastRun":          formatStatusTime(source.LastRun),
+			"lastSuccess":      formatStatusTime(source.LastSuccess),
+			"lastUpdate":       formatStatusTime(source.LastUpdate),
+			"nextRun":          formatStatusTime(source.NextRun),
+		}
+		if source.LastError != nil {
+			fields["lastError"] = source.LastError.Error()
+		}
+		log.WithFields(fields).Infof("status: source")
+	}
+
+	for _, target := range d.targets {
+		connected, prefPath := target.Status()
+		log.WithFields(log.Fields{
+			"target":         target.Name,
+			logging.FieldURL: target.WebUIURL.Redacted(),
+			"connected":      connected,
+			"path":           prefPath,
+		}).Infof("status: qBittorrent target")
+	}
+}
+
+func formatStatusTime(t time.Time) string {
+	if t.IsZero() {
+		return "never"
+	}
+	return t.Format(time.RFC3339)
+}
@@ -0,0 +1,70 @@
+package sync
+
+import (
+	"context"
+	"fmt"
+	"net/url"
+	"path/filepath"
+
+	log "github.com/sirupsen/logrus"
+
+	"github.com/vizv/ipfilter/utils/deluge"
+	"github.com/vizv/ipfilter/utils/logging"
+)
+
+// DelugeTarget is a Deluge Web with Blocklist plugin to point to the active slot when slots are switched.
+type DelugeTarget struct {
+	Name   string
+	WebURL *url.URL
+
+	// PathMap maps the slot path to the path seen by Deluge, e.g. for Deluge in a container.
+	PathMap PathMap
+	// FileURL sends the slot as file:// URL instead of a local path.
+	FileURL bool
+
+	client   *deluge.Client
+	lastHash string
+}
+
+func (t *DelugeTarget) logger() *log.Entry {
+	return log.WithFields(log.Fields{"target": t.Name, logging.FieldURL: t.WebURL.Redacted()})
+}
+
+// Update points the Blocklist plugin to the active slot, and forces it to import the blocklist.
+func (t *DelugeTarget) Update(activePath, activeHash string) error {
+	if activeHash == t.lastHash {
+		return nil
+	}
+
+	if t.client == nil {
+		client, err := deluge.NewClient(t.WebURL)
+		if err != nil {
+			return err
+		}
+		t.client = client
+	}
+
+	blocklistURL := t.PathMap.ToClient(activePath)
+	if t.FileURL {
+		blocklistURL = (&url.URL{Scheme: "file", Path: filepath.ToSlash(blocklistURL)}).String()
+	}
+	if err := t.client.RefreshBlocklist(blocklistURL); err != nil {
+		return fmt.Errorf("error refreshing blocklist: %v", err)
+	}
+
+	t.lastHash = activeHash
+	t.logger().Infof("blocklist imported from %s", blocklistURL)
+	return nil
+}
+
+func (t *DelugeTarget) Section() string {
+	return "deluge." + t.Name
+}
+
+// Notify points the Blocklist plugin to the active slot.
+func (t *DelugeTarget) Notify(ctx context.Context, event *Event) error {
+	if event.ActivePath == "" {
+		return nil
+	}
+	return t.Update(event.ActivePath, event.ActiveHash)
+}
@@ -1,23 +1,42 @@
 package sync
 
 import (
+	"context"
+	"errors"
 	"fmt"
 	"io"
 	"net/http"
+	"net/url"
 )
 
-func Download(url string) ([]byte, error) {
+// Download downloads the URL, errors only contain the URL with its password redacted.
+func Download(ctx context.Context, rawURL string) ([]byte, error) {
 	client := http.Client{}
+	redactedURL := redactURL(rawURL)
 
-	res, err := client.Get(url)
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, rawURL, nil)
 	if err != nil {
-		return nil, fmt.Errorf(`failed to download "%s": %+v`, url, err)
+		return nil, fmt.Errorf(`failed to download "%s": %+v`, redactedURL, urlErrorCause(err))
+	}
+
+	res, err := client.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf(`failed to download "%s": %+v`, redactedURL, urlErrorCause(err))
 	}
 	defer res.Body.Close()
 
 	if res.StatusCode != 200 {
-		return nil, fmt.Errorf(`failed to download "%s" with status: %d`, url, res.StatusCode)
+		return nil, fmt.Errorf(`failed to download "%s" with status: %d`, redactedURL, res.StatusCode)
 	}
 
 	return io.ReadAll(res.Body)
 }
+
+// urlErrorCause strips the URL from url.Error, the URL is already in the message.
+func urlErrorCause(err error) error {
+	var urlErr *url.Error
+	if errors.As(err, &urlErr) {
+		return fmt.Errorf("%s: %v", urlErr.Op, urlErr.Err)
+	}
+	return err
+}
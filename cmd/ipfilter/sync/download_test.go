@@ -0,0 +1,60 @@
+package sync
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestDownload(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/ipfilter.dat" {
+			http.NotFound(w, r)
+			return
+		}
+		w.Write([]byte("1.0.0.0 - 1.0.0.255 , 0 , \n"))
+	}))
+	defer server.Close()
+	serverURL := strings.Replace(server.URL, "://", "://user:secret@", 1)
+
+	datBytes, err := Download(context.Background(), serverURL+"/ipfilter.dat")
+	if err != nil {
+		t.Fatalf("Download() error: %v", err)
+	}
+	if string(datBytes) != "1.0.0.0 - 1.0.0.255 , 0 , \n" {
+		t.Errorf("Download() = %q", datBytes)
+	}
+
+	closed := httptest.NewServer(http.NotFoundHandler())
+	closedURL := strings.Replace(closed.URL, "://", "://user:secret@", 1)
+	closed.Close()
+
+	cancelled, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	tests := []struct {
+		name   string
+		ctx    context.Context
+		rawURL string
+	}{
+		{"status", context.Background(), serverURL + "/missing.dat"},
+		{"connection refused", context.Background(), closedURL + "/ipfilter.dat"},
+		{"cancelled", cancelled, serverURL + "/ipfilter.dat"},
+		{"invalid URL", context.Background(), "http://user:secret@[::1/ipfilter.dat"},
+	}
+	for _, test := range tests {
+		_, err := Download(test.ctx, test.rawURL)
+		if err == nil {
+			t.Errorf("Download(%s) error = nil, want error", test.name)
+			continue
+		}
+		if strings.Contains(err.Error(), "secret") {
+			t.Errorf("Download(%s) error contains the password: %v", test.name, err)
+		}
+		if !strings.Contains(err.Error(), "xxxxx") {
+			t.Errorf("Download(%s) error does not contain the redacted URL: %v", test.name, err)
+		}
+	}
+}
@@ -0,0 +1,91 @@
+package sync
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+)
+
+// ExecNotifier runs a local command for every event, with the event described in IPFILTER_* environment variables.
+type ExecNotifier struct {
+	Name    string
+	Command string
+	Timeout time.Duration
+
+	lastHash string
+}
+
+func (e *ExecNotifier) Section() string {
+	return "exec." + e.Name
+}
+
+func (e *ExecNotifier) logger() *log.Entry {
+	return log.WithField("notifier", e.Section())
+}
+
+// Notify runs the command, successful events are skipped if the command already ran for the active filter.
+func (e *ExecNotifier) Notify(ctx context.Context, event *Event) error {
+	if event.Status == EventSuccess && event.ActiveHash == e.lastHash {
+		return nil
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, e.Timeout)
+	defer cancel()
+	cmd := shellCommand(ctx, e.Command)
+	cmd.Env = append(commandEnviron(), EventEnv(event)...)
+
+	output, err := cmd.CombinedOutput()
+	if len(output) > 0 {
+		e.logger().Debugf("output: %s", strings.TrimSpace(string(output)))
+	}
+	if err != nil {
+		return fmt.Errorf("error running %q: %v", e.Command, err)
+	}
+
+	if event.Status == EventSuccess {
+		e.lastHash = event.ActiveHash
+	}
+	e.logger().Infof("command ran for %s event.", event.Status)
+	return nil
+}
+
+// commandEnviron returns the environment without IPFILTER_* config overrides, so they neither leak secrets to the
+// command nor collide with event variables. IPFILTER_CONFIG is kept for commands running ipfilter.
+func commandEnviron() []string {
+	environ := []string{}
+	for _, env := range os.Environ() {
+		name, _, _ := strings.Cut(env, "=")
+		if strings.HasPrefix(name, "IPFILTER_") && name != "IPFILTER_CONFIG" {
+			continue
+		}
+		environ = append(environ, env)
+	}
+	return environ
+}
+
+// EventEnv describes the event as IPFILTER_* environment variables.
+func EventEnv(event *Event) []string {
+	return []string{
+		"IPFILTER_STATUS=" + event.Status,
+		"IPFILTER_ERROR=" + event.Error,
+		"IPFILTER_TIME=" + event.Time.Format(time.RFC3339),
+		"IPFILTER_MODE=" + event.Mode,
+		"IPFILTER_ACTIVE_PATH=" + event.ActivePath,
+		"IPFILTER_ACTIVE_SLOT=" + event.ActiveSlot,
+		"IPFILTER_ACTIVE_HASH=" + event.ActiveHash,
+		"IPFILTER_CHANGED=" + strconv.FormatBool(event.Changed),
+		"IPFILTER_SOURCES=" + strconv.Itoa(event.Sources),
+		"IPFILTER_DOWNLOADED=" + strconv.Itoa(event.Downloaded),
+		"IPFILTER_UPDATED=" + strconv.Itoa(event.Updated),
+		"IPFILTER_RULES=" + strconv.Itoa(event.Rules),
+		"IPFILTER_MERGED_RULES=" + strconv.Itoa(event.MergedRules),
+		"IPFILTER_ADDED=" + strconv.Itoa(event.Diff.Added),
+		"IPFILTER_REMOVED=" + strconv.Itoa(event.Diff.Removed),
+		"IPFILTER_UNCHANGED=" + strconv.Itoa(event.Diff.Unchanged),
+	}
+}
@@ -1,37 +1,291 @@
 package sync
 
 import (
+	"fmt"
 	"net/url"
+	"sort"
 	"strconv"
 	"strings"
 	"time"
 
 	log "github.com/sirupsen/logrus"
 	"github.com/spf13/viper"
-)
 
-func Interval() time.Duration {
-	interval := viper.GetString("sync.interval")
+	"github.com/vizv/ipfilter/utils/logging"
+)
 
+// ParseInterval parses an interval in seconds or in duration format like "1h2m3s".
+func ParseInterval(interval string) (time.Duration, error) {
 	normalizedDuration := interval
 	if _, err := strconv.ParseInt(normalizedDuration, 0, 64); err == nil {
 		normalizedDuration += "s"
 	}
 
-	updateInterval, err := time.ParseDuration(normalizedDuration)
-	if err != nil || updateInterval < 0 {
-		log.WithField("interval", interval).Warnf("failed to parse update interval, use default interval - %s", DEFAULT_UPDATE_INTERVAL)
-		updateInterval, _ = time.ParseDuration(DEFAULT_UPDATE_INTERVAL)
+	duration, err := time.ParseDuration(normalizedDuration)
+	if err != nil {
+		return 0, err
+	}
+	if duration < 0 {
+		return 0, fmt.Errorf("negative interval: %s", interval)
+	}
+
+	return duration, nil
+}
+
+func Interval() Schedule {
+	interval := viper.GetString("sync.interval")
+
+	updateSchedule, err := ParseSchedule(interval)
+	if err != nil {
+		log.WithField("interval", interval).Warnf("failed to parse update interval: %v, use default interval - %s", err, DEFAULT_UPDATE_INTERVAL)
+		updateSchedule, _ = ParseSchedule(DEFAULT_UPDATE_INTERVAL)
+	}
+
+	return updateSchedule
+}
+
+func Generations() int {
+	generations := viper.GetInt("sync.generations")
+	if generations < MinGenerations || generations > MaxGenerations {
+		log.WithField("generations", generations).Warnf("generations must be between %d and %d, use default generations - %d", MinGenerations, MaxGenerations, DEFAULT_GENERATIONS)
+		generations = DEFAULT_GENERATIONS
+	}
+
+	return generations
+}
+
+// MaxAge returns the age of the active filter after which the daemon is unhealthy, or 0 if disabled.
+func MaxAge() time.Duration {
+	rawMaxAge := viper.GetString("sync.max-age")
+	maxAge, err := ParseInterval(rawMaxAge)
+	if err != nil {
+		log.WithField("max-age", rawMaxAge).Warnf("failed to parse max age: %v, use default max age - %s", err, DEFAULT_MAX_AGE)
+		maxAge, _ = ParseInterval(DEFAULT_MAX_AGE)
+	}
+
+	return maxAge
+}
+
+// MaxFailures returns the number of consecutive failed cycles after which the daemon is unhealthy, or 0 if disabled.
+func MaxFailures() int {
+	maxFailures := viper.GetInt("sync.max-failures")
+	if maxFailures < 0 {
+		log.WithField("max-failures", maxFailures).Warnf("max failures must not be negative, use default max failures - %d", DEFAULT_MAX_FAILURES)
+		maxFailures = DEFAULT_MAX_FAILURES
+	}
+
+	return maxFailures
+}
+
+func Mode() string {
+	mode := viper.GetString("sync.mode")
+	if mode != ModeFilter && mode != ModeBannedIPs {
+		log.WithField("mode", mode).Warnf("unknown sync mode, use default mode - %s", ModeFilter)
+		mode = ModeFilter
+	}
+
+	return mode
+}
+
+// Targets returns the qBittorrent WebUI from sync.webui-url as target "default", followed by targets configured in
+// [qbittorrent.NAME] sections, sorted by name.
+func Targets() []*Target {
+	targets := []*Target{}
+	if target := newTarget("default", "sync"); target != nil {
+		targets = append(targets, target)
+	}
+
+	for _, name := range sectionNames("qbittorrent") {
+		if target := newTarget(name, "qbittorrent."+name); target != nil {
+			targets = append(targets, target)
+		}
+	}
+
+	return targets
+}
+
+func newTarget(name, prefix string) *Target {
+	username := viper.GetString(prefix + ".username")
+	if username == "" {
+		username = DEFAULT_USERNAME
+	}
+	webUIURL := WebUIURL(viper.GetString(prefix+".webui-url"), username, viper.GetString(prefix+".password"))
+	if webUIURL == nil {
+		return nil
+	}
+	webUIURL.Path = ""
+
+	return &Target{Name: name, WebUIURL: webUIURL, PathMap: pathMapSetting(name, prefix)}
+}
+
+// TransmissionTargets returns Transmission targets configured in [transmission.NAME] sections, sorted by name.
+func TransmissionTargets() []*TransmissionTarget {
+	targets := []*TransmissionTarget{}
+	for _, name := range sectionNames("transmission") {
+		prefix := "transmission." + name
+		rpcURL := WebUIURL(viper.GetString(prefix+".rpc-url"), viper.GetString(prefix+".username"), viper.GetString(prefix+".password"))
+		if rpcURL == nil {
+			log.WithField("target", name).Warnf("rpc-url not set, skipping...")
+			continue
+		}
+		if rpcURL.Path == "" {
+			rpcURL.Path = DEFAULT_TRANSMISSION_RPC_PATH
+		}
+
+		blocklistDir := viper.GetString(prefix + ".blocklist-dir")
+		if blocklistDir == "" {
+			log.WithField("target", name).Warnf("blocklist-dir not set, skipping...")
+			continue
+		}
+
+		target := &TransmissionTarget{Name: name, RPCURL: rpcURL, BlocklistDir: blocklistDir, PathMap: pathMapSetting(name, prefix)}
+		targets = append(targets, target)
+	}
+
+	return targets
+}
+
+// DelugeTargets returns Deluge targets configured in [deluge.NAME] sections, sorted by name.
+func DelugeTargets() []*DelugeTarget {
+	targets := []*DelugeTarget{}
+	for _, name := range sectionNames("deluge") {
+		prefix := "deluge." + name
+		webURL := WebUIURL(viper.GetString(prefix+".web-url"), "", "")
+		if webURL == nil {
+			log.WithField("target", name).Warnf("web-url not set, skipping...")
+			continue
+		}
+		// Deluge Web authenticates with password only
+		webURL.User = url.UserPassword("", viper.GetString(prefix+".password"))
+
+		target := &DelugeTarget{Name: name, WebURL: webURL, FileURL: viper.GetBool(prefix + ".file-url"), PathMap: pathMapSetting(name, prefix)}
+		targets = append(targets, target)
+	}
+
+	return targets
+}
+
+// WebhookNotifiers returns webhooks configured in [webhook.NAME] sections, sorted by name.
+func WebhookNotifiers() []*WebhookNotifier {
+	notifiers := []*WebhookNotifier{}
+	for _, name := range sectionNames("webhook") {
+		prefix := "webhook." + name
+		rawURL := viper.GetString(prefix + ".url")
+		webhookURL, err := url.ParseRequestURI(rawURL)
+		if err != nil || (webhookURL.Scheme != "http" && webhookURL.Scheme != "https") {
+			log.WithFields(log.Fields{"notifier": prefix, logging.FieldURL: rawURL}).Warnf("invalid webhook URL, skipping...")
+			continue
+		}
+
+		notifiers = append(notifiers, &WebhookNotifier{Name: name, URL: webhookURL, Timeout: notifyTimeout(prefix)})
 	}
 
-	return updateInterval
+	return notifiers
 }
 
-func WebUIURL() *url.URL {
-	webUIURL := viper.GetString("sync.webui-url")
-	username := viper.GetString("sync.username")
-	password := viper.GetString("sync.password")
+// ExecNotifiers returns exec hooks configured in [exec.NAME] sections, sorted by name.
+func ExecNotifiers() []*ExecNotifier {
+	notifiers := []*ExecNotifier{}
+	for _, name := range sectionNames("exec") {
+		prefix := "exec." + name
+		command := viper.GetString(prefix + ".command")
+		if command == "" {
+			log.WithField("notifier", prefix).Warnf("command not set, skipping...")
+			continue
+		}
+
+		notifiers = append(notifiers, &ExecNotifier{Name: name, Command: command, Timeout: notifyTimeout(prefix)})
+	}
+
+	return notifiers
+}
+
+func notifyTimeout(prefix string) time.Duration {
+	rawTimeout := viper.GetString(prefix + ".timeout")
+	if rawTimeout == "" {
+		rawTimeout = DEFAULT_NOTIFY_TIMEOUT
+	}
+
+	timeout, err := ParseInterval(rawTimeout)
+	if err != nil || timeout == 0 {
+		log.WithFields(log.Fields{"notifier": prefix, "timeout": rawTimeout}).Warnf("invalid timeout, use default timeout - %s", DEFAULT_NOTIFY_TIMEOUT)
+		timeout, _ = ParseInterval(DEFAULT_NOTIFY_TIMEOUT)
+	}
 
+	return timeout
+}
+
+// pathMapSetting returns the path mapping of the target, or no mapping if the path mapping is invalid.
+func pathMapSetting(name, prefix string) PathMap {
+	pathMap, err := PathMapSetting(viper.Get(prefix + ".path-map"))
+	if err != nil {
+		log.WithField("target", name).Warnf("%v, path mapping disabled", err)
+		return nil
+	}
+	return pathMap
+}
+
+// ListSetting returns items of a list setting, which is a comma separated string in INI, or a list in YAML, TOML and
+// JSON. A list item may also be a source {url, interval}, or a path mapping {host, client}. Items of INI strings can
+// not contain commas, e.g. a cron expression "0 4,16 * * *" of a source must be set in a list instead.
+func ListSetting(value any) []string {
+	items := []string{}
+	switch value := value.(type) {
+	case nil:
+	case string:
+		for _, item := range strings.Split(value, ",") {
+			if item = strings.TrimSpace(item); item != "" {
+				items = append(items, item)
+			}
+		}
+	case []string:
+		for _, item := range value {
+			if item = strings.TrimSpace(item); item != "" {
+				items = append(items, item)
+			}
+		}
+	case []any:
+		for _, item := range value {
+			if item := listItem(item); item != "" {
+				items = append(items, item)
+			}
+		}
+	default:
+		items = append(items, fmt.Sprint(value))
+	}
+	return items
+}
+
+func listItem(item any) string {
+	fields, ok := item.(map[string]any)
+	if !ok {
+		return strings.TrimSpace(fmt.Sprint(item))
+	}
+
+	if datURL, ok := fields["url"]; ok {
+		if interval, ok := fields["interval"]; ok {
+			return fmt.Sprintf("%v%s%v", datURL, sourceIntervalSeparator, interval)
+		}
+		return fmt.Sprint(datURL)
+	}
+	if host, ok := fields["host"]; ok {
+		return fmt.Sprintf("%v%s%v", host, pathMapSeparator, fields["client"])
+	}
+	return ""
+}
+
+// sectionNames returns the names of [PREFIX.NAME] sections, sorted by name.
+func sectionNames(prefix string) []string {
+	names := []string{}
+	for name := range viper.GetStringMap(prefix) {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	return names
+}
+
+func WebUIURL(webUIURL, username, password string) *url.URL {
 	if webUIURL == "" {
 		return nil
 	}
@@ -43,7 +297,7 @@ func WebUIURL() *url.URL {
 
 	parsedURL, err := url.ParseRequestURI(normalizedURL)
 	if err != nil {
-		log.WithField("url", webUIURL).Warnf("invalid WebUI URL, disable notify")
+		log.WithField(logging.FieldURL, webUIURL).Warnf("invalid WebUI URL, disable notify")
 		return nil
 	}
 
@@ -51,7 +305,5 @@ func WebUIURL() *url.URL {
 		parsedURL.User = url.UserPassword(username, password)
 	}
 
-	parsedURL.Path = ""
-
 	return parsedURL
 }
@@ -0,0 +1,67 @@
+package sync
+
+import (
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestParseInterval(t *testing.T) {
+	tests := []struct {
+		interval string
+		want     time.Duration
+		ok       bool
+	}{
+		{"900", 900 * time.Second, true},
+		{"15m", 15 * time.Minute, true},
+		{"0", 0, true},
+		{"-1", 0, false},
+		{"-1m", 0, false},
+		{"", 0, false},
+		{"10 4 * * *", 0, false},
+	}
+	for _, test := range tests {
+		got, err := ParseInterval(test.interval)
+		if (err == nil) != test.ok {
+			t.Errorf("ParseInterval(%q) error = %v, want ok %v", test.interval, err, test.ok)
+			continue
+		}
+		if got != test.want {
+			t.Errorf("ParseInterval(%q) = %s, want %s", test.interval, got, test.want)
+		}
+	}
+}
+
+func TestListSetting(t *testing.T) {
+	tests := []struct {
+		name  string
+		value any
+		want  []string
+	}{
+		{"nil", nil, []string{}},
+		{"empty string", "", []string{}},
+		{"comma separated", " https://a/ipfilter.dat , ,https://b/ipfilter.dat|1h ", []string{"https://a/ipfilter.dat", "https://b/ipfilter.dat|1h"}},
+		{"string list", []string{" a ", "", "b,c"}, []string{"a", "b,c"}},
+		{"scalar", 42, []string{"42"}},
+		{"list items", []any{
+			"https://a/ipfilter.dat|10 4 * * *",
+			map[string]any{"url": "https://b/ipfilter.dat"},
+			map[string]any{"url": "https://c/ipfilter.dat", "interval": "CRON_TZ=Asia/Shanghai 0 */6 * * *"},
+			map[string]any{"url": "https://d/ipfilter.dat", "interval": 3600},
+			map[string]any{"host": "/srv/ipfilter", "client": "/config"},
+			map[string]any{"unknown": "ignored"},
+			" ",
+		}, []string{
+			"https://a/ipfilter.dat|10 4 * * *",
+			"https://b/ipfilter.dat",
+			"https://c/ipfilter.dat|CRON_TZ=Asia/Shanghai 0 */6 * * *",
+			"https://d/ipfilter.dat|3600",
+			"/srv/ipfilter:/config",
+		}},
+	}
+	for _, test := range tests {
+		if got := ListSetting(test.value); !reflect.DeepEqual(got, test.want) {
+			t.Errorf("ListSetting(%s) = %q, want %q", test.name, got, test.want)
+		}
+	}
+}
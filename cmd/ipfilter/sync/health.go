@@ -0,0 +1,71 @@
+package sync
+
+import (
+	"fmt"
+	"time"
+)
+
+// recordCycle updates the health state after a cycle. A cycle fails if merging or activating failed, or if every due
+// source failed to download. The active filter is verified by a successful cycle after it was activated.
+func (d *Daemon) recordCycle(now time.Time, due, downloaded int, err error, activated bool) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	if err == nil {
+		err = downloadsFailed(due, downloaded)
+	}
+	if err != nil {
+		d.failedCycles += 1
+		d.cycleError = err
+		return
+	}
+	d.failedCycles, d.cycleError = 0, nil
+	if activated {
+		d.activated = true
+	}
+	if d.activated {
+		d.lastVerified = now
+	}
+}
+
+// Ready returns an error until the first successful activation.
+func (d *Daemon) Ready() error {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	if !d.activated {
+		return fmt.Errorf("no filter activated yet")
+	}
+	return nil
+}
+
+// Healthy returns an error if the last cycles all failed, or the active filter or the rules of any source are older
+// than the max age, e.g. a source failing to download while others succeed.
+func (d *Daemon) Healthy() error {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	if d.maxFailures > 0 && d.failedCycles >= d.maxFailures {
+		return fmt.Errorf("last %d cycles failed: %v", d.failedCycles, d.cycleError)
+	}
+	if age := time.Since(d.lastVerified); d.maxAge > 0 && d.activated && age > d.maxAge {
+		return fmt.Errorf("active filter last verified %s ago, older than %s", age.Round(time.Second), d.maxAge)
+	}
+	if d.maxAge > 0 && d.activated {
+		for _, source := range d.scheduler.Sources {
+			lastRefresh := source.LastRefresh()
+			if age := time.Since(lastRefresh); !lastRefresh.IsZero() && age > d.maxAge {
+				return fmt.Errorf("source %s not downloaded successfully for %s, longer than %s", source.Redacted(), age.Round(time.Second), d.maxAge)
+			}
+		}
+	}
+	return nil
+}
+
+// downloadsFailed returns an error if all due sources failed to download, the cycle is failed even if merging is skipped.
+func downloadsFailed(due, downloaded int) error {
+	if due > 0 && downloaded == 0 {
+		return fmt.Errorf("failed to download all %d due sources", due)
+	}
+	return nil
+}
@@ -0,0 +1,73 @@
+package sync
+
+import (
+	"math/big"
+	"time"
+
+	"github.com/vizv/ipfilter/utils/iprange"
+	"github.com/vizv/ipfilter/utils/metrics"
+)
+
+const (
+	resultSuccess = "success"
+	resultFailure = "failure"
+)
+
+var (
+	metricSourceDownloads        = metrics.NewCounter("ipfilter_source_downloads_total", "Downloads of sources by result.", "url", "result")
+	metricSourceDownloadDuration = metrics.NewSummary("ipfilter_source_download_duration_seconds", "Time spent downloading sources.", "url")
+	metricSourceDownloadBytes    = metrics.NewCounter("ipfilter_source_download_bytes_total", "Bytes downloaded from sources.", "url")
+	metricSourceLastSuccess      = metrics.NewGauge("ipfilter_source_last_success_timestamp_seconds", "Unix time of the last successful download of sources.", "url")
+	metricSourceLastUpdate       = metrics.NewGauge("ipfilter_source_last_update_timestamp_seconds", "Unix time of the last download changing the cache of sources.", "url")
+	metricSourceRules            = metrics.NewGauge("ipfilter_source_rules", "Rules in the cache of sources.", "url")
+	metricRules                  = metrics.NewGauge("ipfilter_rules", "Rules of the last merge, collected from all sources and merged.", "stage")
+	metricBlockedAddresses       = metrics.NewGauge("ipfilter_blocked_addresses", "Addresses blocked by the merged rules.", "family")
+	metricSlotSwitches           = metrics.NewCounter("ipfilter_slot_switches_total", "Activations of a new slot.")
+	metricQBittorrentNotify      = metrics.NewCounter("ipfilter_qbittorrent_notifications_total", "Slot switches and banned IPs pushed to qBittorrent targets by result.", "target", "result")
+	metricNotifications          = metrics.NewCounter("ipfilter_notifications_total", "Notifications sent after merging by notifier and result.", "notifier", "result")
+)
+
+// observeDownload records a download of the source.
+func observeDownload(source *Source, started time.Time, size int, err error) {
+	metricSourceDownloadDuration.Observe(time.Since(started).Seconds(), source.Redacted())
+	if err != nil {
+		metricSourceDownloads.Inc(source.Redacted(), resultFailure)
+		return
+	}
+	metricSourceDownloads.Inc(source.Redacted(), resultSuccess)
+	metricSourceDownloadBytes.Add(float64(size), source.Redacted())
+}
+
+// observeMerged records the rules count and blocked addresses of merged rules.
+func observeMerged(rulesCount int, intervals iprange.Intervals) {
+	metricRules.Set(float64(rulesCount), "collected")
+	metricRules.Set(float64(len(intervals)), "merged")
+
+	ipv4, ipv6 := big.NewInt(0), big.NewInt(0)
+	for _, interval := range intervals {
+		if interval.From.Is4() {
+			ipv4.Add(ipv4, interval.Size())
+		} else {
+			ipv6.Add(ipv6, interval.Size())
+		}
+	}
+	ipv4Count, _ := ipv4.Float64()
+	ipv6Count, _ := ipv6.Float64()
+	metricBlockedAddresses.Set(ipv4Count, "ipv4")
+	metricBlockedAddresses.Set(ipv6Count, "ipv6")
+}
+
+// resultLabel returns the result label of an error.
+func resultLabel(err error) string {
+	if err != nil {
+		return resultFailure
+	}
+	return resultSuccess
+}
+
+// forgetSource removes the metrics of a source no longer configured, so it is not reported as stale.
+func forgetSource(source *Source) {
+	for _, f := range []*metrics.Family{metricSourceDownloads, metricSourceDownloadDuration, metricSourceDownloadBytes, metricSourceLastSuccess, metricSourceLastUpdate, metricSourceRules} {
+		f.DeleteLabel("url", source.Redacted())
+	}
+}
@@ -0,0 +1,97 @@
+package sync
+
+import (
+	"context"
+	"net/netip"
+	"time"
+
+	"github.com/vizv/ipfilter/utils/iprange"
+)
+
+const (
+	EventSuccess = "success"
+	EventFailure = "failure"
+)
+
+// Event describes the result of merging and activating rules, or the failure of all due downloads, it is passed to
+// every notifier.
+type Event struct {
+	Status string    `json:"status"`
+	Error  string    `json:"error,omitempty"`
+	Time   time.Time `json:"time"`
+	Mode   string    `json:"mode"`
+
+	// ActivePath is the absolute path of the active slot, empty in banned-ips mode or if no slot is active.
+	ActivePath string `json:"active_path,omitempty"`
+	ActiveSlot string `json:"active_slot,omitempty"`
+	// ActiveHash is the MD5 of the active slot, or of the banned IPs pushed in banned-ips mode.
+	ActiveHash string `json:"active_hash,omitempty"`
+	// Changed reports whether the active filter is changed by this event.
+	Changed bool `json:"changed"`
+
+	Sources     int  `json:"sources"`
+	Downloaded  int  `json:"downloaded"`
+	Updated     int  `json:"updated"`
+	Rules       int  `json:"rules"`
+	MergedRules int  `json:"merged_rules"`
+	Diff        Diff `json:"diff"`
+}
+
+// Diff summarizes merged rules compared with the previously merged rules.
+type Diff struct {
+	Added     int `json:"added"`
+	Removed   int `json:"removed"`
+	Unchanged int `json:"unchanged"`
+}
+
+// DiffIntervals counts the ranges only in the new intervals, only in the old intervals, and in both.
+func DiffIntervals(old, new iprange.Intervals) Diff {
+	oldRanges := map[[2]netip.Addr]bool{}
+	for _, interval := range old {
+		oldRanges[[2]netip.Addr{interval.From.Addr, interval.To.Addr}] = true
+	}
+
+	diff := Diff{}
+	for _, interval := range new {
+		key := [2]netip.Addr{interval.From.Addr, interval.To.Addr}
+		if oldRanges[key] {
+			diff.Unchanged += 1
+			delete(oldRanges, key)
+		} else {
+			diff.Added += 1
+		}
+	}
+	diff.Removed = len(oldRanges)
+
+	return diff
+}
+
+// Notifier is notified after merged rules are activated, or failed to.
+type Notifier interface {
+	// Section returns the config section of the notifier, e.g. "webhook.chat".
+	Section() string
+	// Notify handles the event, the event is sent again on the next merge if an error is returned.
+	Notify(ctx context.Context, event *Event) error
+}
+
+// Notifiers returns all notifiers, the qBittorrent targets followed by other configured notifiers.
+func Notifiers(targets []*Target) []Notifier {
+	notifiers := []Notifier{}
+	for _, target := range targets {
+		notifiers = append(notifiers, target)
+	}
+	for _, target := range TransmissionTargets() {
+		notifiers = append(notifiers, target)
+	}
+	for _, target := range DelugeTargets() {
+		notifiers = append(notifiers, target)
+	}
+	for _, webhook := range WebhookNotifiers() {
+		notifiers = append(notifiers, webhook)
+	}
+	for _, hook := range ExecNotifiers() {
+		notifiers = append(notifiers, hook)
+	}
+
+	return notifiers
+}
@@ -0,0 +1,149 @@
+package sync
+
+import (
+	"fmt"
+	"strings"
+)
+
+// pathMapSeparator separates the host prefix from the client prefix in a path mapping, e.g. "/srv/ipfilter:/config".
+const pathMapSeparator = ":"
+
+// PathMapping maps paths under Host on this machine to paths under Client seen by qBittorrent.
+type PathMapping struct {
+	Host   string
+	Client string
+}
+
+// PathMap is a list of path mappings, the mapping with the longest matching prefix applies.
+type PathMap []PathMapping
+
+// ParsePathMap parses comma separated path mappings "HOST_PREFIX:CLIENT_PREFIX", e.g.
+// "/srv/ipfilter:/config/ipfilter,/mnt/data:/data", see ParsePathMapping.
+func ParsePathMap(rawPathMap string) (PathMap, error) {
+	pathMap := PathMap{}
+	for _, rawMapping := range strings.Split(rawPathMap, ",") {
+		rawMapping = strings.TrimSpace(rawMapping)
+		if rawMapping == "" {
+			continue
+		}
+
+		mapping, err := ParsePathMapping(rawMapping)
+		if err != nil {
+			return nil, err
+		}
+		pathMap = append(pathMap, mapping)
+	}
+	return pathMap, nil
+}
+
+// ParsePathMapping parses a path mapping "HOST_PREFIX:CLIENT_PREFIX", split at the first separator which is not the
+// colon of a Windows drive letter, e.g. "/srv/ipfilter:/config", "/data:D:\downloads" or "C:\ipfilter:/config".
+func ParsePathMapping(rawMapping string) (PathMapping, error) {
+	for i := 0; i < len(rawMapping); i++ {
+		if !strings.HasPrefix(rawMapping[i:], pathMapSeparator) || isDriveColon(rawMapping, i) {
+			continue
+		}
+		if i == 0 || i == len(rawMapping)-1 {
+			break
+		}
+		return PathMapping{rawMapping[:i], rawMapping[i+1:]}, nil
+	}
+	return PathMapping{}, fmt.Errorf(`invalid path mapping "%s", expecting "HOST_PREFIX%sCLIENT_PREFIX"`, rawMapping, pathMapSeparator)
+}
+
+// isDriveColon reports whether the colon at i follows a drive letter starting the host or the client path, e.g. "D:\".
+func isDriveColon(rawMapping string, i int) bool {
+	if i < 1 || (i > 1 && rawMapping[i-2] != ':') {
+		return false
+	}
+	letter := rawMapping[i-1]
+	if (letter < 'a' || letter > 'z') && (letter < 'A' || letter > 'Z') {
+		return false
+	}
+	return i == len(rawMapping)-1 || rawMapping[i+1] == '\\' || rawMapping[i+1] == '/'
+}
+
+// PathMapSetting returns the path mappings of a path-map setting. Structured {host, client} items of YAML, TOML and
+// JSON lists are used as is, while strings are parsed by ParsePathMapping, e.g. comma separated mappings in INI.
+func PathMapSetting(value any) (PathMap, error) {
+	items, ok := value.([]any)
+	if !ok {
+		return ParsePathMap(strings.Join(ListSetting(value), ","))
+	}
+
+	pathMap := PathMap{}
+	for _, item := range items {
+		fields, ok := item.(map[string]any)
+		if !ok {
+			mapping, err := ParsePathMapping(strings.TrimSpace(fmt.Sprint(item)))
+			if err != nil {
+				return nil, err
+			}
+			pathMap = append(pathMap, mapping)
+			continue
+		}
+
+		host, _ := fields["host"].(string)
+		client, _ := fields["client"].(string)
+		if host == "" || client == "" {
+			return nil, fmt.Errorf("invalid path mapping %v, expecting {host, client}", fields)
+		}
+		pathMap = append(pathMap, PathMapping{host, client})
+	}
+	return pathMap, nil
+}
+
+// ToClient maps the host path to the path seen by qBittorrent, unmapped paths are returned as is.
+func (m PathMap) ToClient(hostPath string) string {
+	return m.apply(hostPath, func(mapping PathMapping) (string, string) { return mapping.Host, mapping.Client })
+}
+
+// ToHost maps the path seen by qBittorrent back to the host path, unmapped paths are returned as is.
+func (m PathMap) ToHost(clientPath string) string {
+	return m.apply(clientPath, func(mapping PathMapping) (string, string) { return mapping.Client, mapping.Host })
+}
+
+func (m PathMap) apply(p string, direction func(PathMapping) (string, string)) string {
+	from, to := "", ""
+	for _, mapping := range m {
+		mappingFrom, mappingTo := direction(mapping)
+		if hasPathPrefix(p, mappingFrom) && len(mappingFrom) > len(from) {
+			from, to = mappingFrom, mappingTo
+		}
+	}
+	if from == "" {
+		return p
+	}
+
+	rest := strings.TrimLeft(strings.TrimPrefix(p, strings.TrimRight(from, `/\`)), `/\`)
+	if rest == "" {
+		return to
+	}
+	return strings.TrimRight(to, `/\`) + pathSeparatorOf(to) + rest
+}
+
+// hasPathPrefix reports whether p is prefix or under prefix, regardless of path separators.
+func hasPathPrefix(p, prefix string) bool {
+	prefix = strings.TrimRight(prefix, `/\`)
+	if !strings.HasPrefix(p, prefix) {
+		return false
+	}
+	rest := p[len(prefix):]
+	return rest == "" || rest[0] == '/' || rest[0] == '\\' || prefix == ""
+}
+
+// pathSeparatorOf guesses the path separator used by the path, so Windows paths keep backslashes.
+func pathSeparatorOf(p string) string {
+	if strings.Contains(p, `\`) && !strings.Contains(p, "/") {
+		return `\`
+	}
+	return "/"
+}
+
+// SamePath compares paths regardless of path separators and trailing separators.
+func SamePath(a, b string) bool {
+	normalize := func(p string) string {
+		return strings.TrimRight(strings.ReplaceAll(p, `\`, "/"), "/")
+	}
+	return normalize(a) == normalize(b)
+}
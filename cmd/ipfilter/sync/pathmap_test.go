@@ -0,0 +1,157 @@
+package sync
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestParsePathMapping(t *testing.T) {
+	tests := []struct {
+		raw  string
+		want PathMapping
+		ok   bool
+	}{
+		{"/srv/ipfilter:/config", PathMapping{"/srv/ipfilter", "/config"}, true},
+		{"/srv/ipfilter:/config/ipfilter:old", PathMapping{"/srv/ipfilter", "/config/ipfilter:old"}, true},
+		{`/data:D:\downloads`, PathMapping{"/data", `D:\downloads`}, true},
+		{`C:\ipfilter:/config`, PathMapping{`C:\ipfilter`, "/config"}, true},
+		{`C:\ipfilter:D:\ipfilter`, PathMapping{`C:\ipfilter`, `D:\ipfilter`}, true},
+		{"C:/ipfilter:/config", PathMapping{"C:/ipfilter", "/config"}, true},
+		{"/srv:D:", PathMapping{"/srv", "D:"}, true},
+		{"/mnt/c:/config", PathMapping{"/mnt/c", "/config"}, true},
+		{"relative:dir", PathMapping{"relative", "dir"}, true},
+		{"/srv/ipfilter", PathMapping{}, false},
+		{":/config", PathMapping{}, false},
+		{"/srv/ipfilter:", PathMapping{}, false},
+		{`C:\ipfilter`, PathMapping{}, false},
+		{"", PathMapping{}, false},
+	}
+	for _, test := range tests {
+		got, err := ParsePathMapping(test.raw)
+		if (err == nil) != test.ok {
+			t.Errorf("ParsePathMapping(%q) error = %v, want ok %v", test.raw, err, test.ok)
+			continue
+		}
+		if got != test.want {
+			t.Errorf("ParsePathMapping(%q) = %+v, want %+v", test.raw, got, test.want)
+		}
+	}
+}
+
+func TestParsePathMap(t *testing.T) {
+	tests := []struct {
+		raw  string
+		want PathMap
+		ok   bool
+	}{
+		{"", PathMap{}, true},
+		{"/srv/ipfilter:/config", PathMap{{"/srv/ipfilter", "/config"}}, true},
+		{" /srv/ipfilter:/config , /mnt/data:/data ,", PathMap{{"/srv/ipfilter", "/config"}, {"/mnt/data", "/data"}}, true},
+		{`/srv/ipfilter:C:\ipfilter,D:\data:/data`, PathMap{{"/srv/ipfilter", `C:\ipfilter`}, {`D:\data`, "/data"}}, true},
+		{"/srv/ipfilter:/config,/mnt/data", nil, false},
+	}
+	for _, test := range tests {
+		got, err := ParsePathMap(test.raw)
+		if (err == nil) != test.ok {
+			t.Errorf("ParsePathMap(%q) error = %v, want ok %v", test.raw, err, test.ok)
+			continue
+		}
+		if test.ok && !reflect.DeepEqual(got, test.want) {
+			t.Errorf("ParsePathMap(%q) = %+v, want %+v", test.raw, got, test.want)
+		}
+	}
+}
+
+func TestPathMapSetting(t *testing.T) {
+	tests := []struct {
+		name  string
+		value any
+		want  PathMap
+		ok    bool
+	}{
+		{"nil", nil, PathMap{}, true},
+		{"INI string", `/srv/ipfilter:/config,/data:D:\downloads`, PathMap{{"/srv/ipfilter", "/config"}, {"/data", `D:\downloads`}}, true},
+		{"string list", []string{"/srv/ipfilter:/config", `C:\ipfilter:/ipfilter`}, PathMap{{"/srv/ipfilter", "/config"}, {`C:\ipfilter`, "/ipfilter"}}, true},
+		{"structured items", []any{
+			map[string]any{"host": "/srv/ip,filter", "client": `C:\ip:filter`},
+			" /mnt/data:/data ",
+		}, PathMap{{"/srv/ip,filter", `C:\ip:filter`}, {"/mnt/data", "/data"}}, true},
+		{"structured item without client", []any{map[string]any{"host": "/srv/ipfilter"}}, nil, false},
+		{"invalid string item", []any{"/srv/ipfilter"}, nil, false},
+	}
+	for _, test := range tests {
+		got, err := PathMapSetting(test.value)
+		if (err == nil) != test.ok {
+			t.Errorf("PathMapSetting(%s) error = %v, want ok %v", test.name, err, test.ok)
+			continue
+		}
+		if test.ok && !reflect.DeepEqual(got, test.want) {
+			t.Errorf("PathMapSetting(%s) = %+v, want %+v", test.name, got, test.want)
+		}
+	}
+}
+
+func TestPathMapToClientToHost(t *testing.T) {
+	pathMap := PathMap{
+		{"/srv/ipfilter", "/config"},
+		{"/srv/ipfilter/out", "/out"},
+		{"/srv/data/", `D:\data\`},
+	}
+	tests := []struct {
+		host   string
+		client string
+	}{
+		{"/srv/ipfilter", "/config"},
+		{"/srv/ipfilter/ipfilter-a.dat", "/config/ipfilter-a.dat"},
+		{"/srv/ipfilter/out/ipfilter-b.dat", "/out/ipfilter-b.dat"},
+		{"/srv/data/ipfilter-a.dat", `D:\data\ipfilter-a.dat`},
+		{"/srv/data", `D:\data\`},
+	}
+	for _, test := range tests {
+		if got := pathMap.ToClient(test.host); got != test.client {
+			t.Errorf("ToClient(%q) = %q, want %q", test.host, got, test.client)
+		}
+	}
+
+	reverse := []struct {
+		client string
+		host   string
+	}{
+		{"/config/ipfilter-a.dat", "/srv/ipfilter/ipfilter-a.dat"},
+		{"/out/ipfilter-b.dat", "/srv/ipfilter/out/ipfilter-b.dat"},
+		{`D:\data\ipfilter-a.dat`, "/srv/data/ipfilter-a.dat"},
+		{"/configs/ipfilter-a.dat", "/configs/ipfilter-a.dat"},
+	}
+	for _, test := range reverse {
+		if got := pathMap.ToHost(test.client); got != test.host {
+			t.Errorf("ToHost(%q) = %q, want %q", test.client, got, test.host)
+		}
+	}
+
+	unmapped := []string{"/srv/ipfilters/ipfilter-a.dat", "/tmp/ipfilter-a.dat", ""}
+	for _, p := range unmapped {
+		if got := pathMap.ToClient(p); got != p {
+			t.Errorf("ToClient(%q) = %q, want unmapped", p, got)
+		}
+	}
+	if got := (PathMap{}).ToClient("/srv/ipfilter"); got != "/srv/ipfilter" {
+		t.Errorf("empty ToClient() = %q, want unmapped", got)
+	}
+}
+
+func TestSamePath(t *testing.T) {
+	tests := []struct {
+		a, b string
+		same bool
+	}{
+		{"/config/ipfilter-a.dat", "/config/ipfilter-a.dat", true},
+		{"/config/", "/config", true},
+		{`C:\ipfilter\ipfilter-a.dat`, "C:/ipfilter/ipfilter-a.dat", true},
+		{"/config/ipfilter-a.dat", "/config/ipfilter-b.dat", false},
+	}
+	for _, test := range tests {
+		if got := SamePath(test.a, test.b); got != test.same {
+			t.Errorf("SamePath(%q, %q) = %v, want %v", test.a, test.b, got, test.same)
+		}
+	}
+}
@@ -0,0 +1,25 @@
+package sync
+
+import (
+	log "github.com/sirupsen/logrus"
+
+	"github.com/vizv/ipfilter/utils/iprange"
+	"github.com/vizv/ipfilter/utils/logging"
+	"github.com/vizv/ipfilter/utils/parser"
+)
+
+// LoadIntervals collects rules from ipfilter.dat files, and returns the collected intervals and the rules count.
+func LoadIntervals(files ...string) (iprange.Intervals, int) {
+	intervals := iprange.Intervals{}
+	rulesCount := 0
+	for _, file := range files {
+		log.WithField(logging.FieldFile, file).Infof(`collecting rules from "%s"...`, file)
+		for rule := range parser.ParseIPFilterDatFile(file) {
+			from, to := rule[0], rule[1]
+			log.WithFields(log.Fields{logging.FieldFile: file, "from": from, "to": to}).Tracef("read rule")
+			intervals.Append(from, to)
+			rulesCount += 1
+		}
+	}
+	return intervals, rulesCount
+}
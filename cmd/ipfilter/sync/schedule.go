@@ -0,0 +1,55 @@
+package sync
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/robfig/cron/v3"
+)
+
+// Schedule returns the next activation time later than the given time, or zero time if never activated again.
+type Schedule interface {
+	Next(time.Time) time.Time
+	String() string
+}
+
+// ParseSchedule parses an interval like "900" or "15m", or a cron expression like "10 4 * * *" with optional timezone
+// prefix like "CRON_TZ=Asia/Shanghai 0 */6 * * *". A zero interval is a schedule never activated again.
+func ParseSchedule(spec string) (Schedule, error) {
+	interval, intervalErr := ParseInterval(spec)
+	if intervalErr == nil {
+		return intervalSchedule(interval), nil
+	}
+
+	schedule, cronErr := cron.ParseStandard(spec)
+	if cronErr != nil {
+		return nil, fmt.Errorf(`invalid schedule "%s": not an interval (%v) nor a cron expression (%v)`, spec, intervalErr, cronErr)
+	}
+
+	return cronSchedule{schedule, spec}, nil
+}
+
+type intervalSchedule time.Duration
+
+func (s intervalSchedule) Next(t time.Time) time.Time {
+	if s == 0 {
+		return time.Time{}
+	}
+	return t.Add(time.Duration(s))
+}
+
+func (s intervalSchedule) String() string {
+	if s == 0 {
+		return "once"
+	}
+	return fmt.Sprintf("every %s", time.Duration(s))
+}
+
+type cronSchedule struct {
+	cron.Schedule
+	spec string
+}
+
+func (s cronSchedule) String() string {
+	return fmt.Sprintf(`cron "%s"`, s.spec)
+}
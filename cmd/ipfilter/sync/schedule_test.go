@@ -0,0 +1,48 @@
+package sync
+
+import (
+	"testing"
+	"time"
+	_ "time/tzdata"
+)
+
+func TestParseSchedule(t *testing.T) {
+	now := time.Date(2024, 1, 1, 0, 30, 0, 0, time.UTC)
+	tests := []struct {
+		spec   string
+		string string
+		next   time.Time
+	}{
+		{"900", "every 15m0s", now.Add(15 * time.Minute)},
+		{"15m", "every 15m0s", now.Add(15 * time.Minute)},
+		{"1h30m", "every 1h30m0s", now.Add(90 * time.Minute)},
+		{"0", "once", time.Time{}},
+		{"0s", "once", time.Time{}},
+		{"10 4 * * *", `cron "10 4 * * *"`, time.Date(2024, 1, 1, 4, 10, 0, 0, time.UTC)},
+		{"@daily", `cron "@daily"`, time.Date(2024, 1, 2, 0, 0, 0, 0, time.UTC)},
+		// 00:30 UTC is 08:30 in Shanghai, the next run is 12:00 in Shanghai
+		{"CRON_TZ=Asia/Shanghai 0 */6 * * *", `cron "CRON_TZ=Asia/Shanghai 0 */6 * * *"`, time.Date(2024, 1, 1, 4, 0, 0, 0, time.UTC)},
+		{"TZ=America/New_York 0 0 * * *", `cron "TZ=America/New_York 0 0 * * *"`, time.Date(2024, 1, 1, 5, 0, 0, 0, time.UTC)},
+	}
+	for _, test := range tests {
+		schedule, err := ParseSchedule(test.spec)
+		if err != nil {
+			t.Errorf("ParseSchedule(%q) error: %v", test.spec, err)
+			continue
+		}
+		if got := schedule.String(); got != test.string {
+			t.Errorf("ParseSchedule(%q).String() = %q, want %q", test.spec, got, test.string)
+		}
+		if got := schedule.Next(now); !got.Equal(test.next) {
+			t.Errorf("ParseSchedule(%q).Next(%s) = %s, want %s", test.spec, now, got, test.next)
+		}
+	}
+}
+
+func TestParseScheduleInvalid(t *testing.T) {
+	for _, spec := range []string{"", "-5", "-1m", "soon", "61 * * * *", "* * * *", "CRON_TZ=Nowhere/City 0 * * * *"} {
+		if schedule, err := ParseSchedule(spec); err == nil {
+			t.Errorf("ParseSchedule(%q) = %s, want error", spec, schedule)
+		}
+	}
+}
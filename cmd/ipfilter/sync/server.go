@@ -0,0 +1,258 @@
+package sync
+
+import (
+	"bytes"
+	"compress/gzip"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+
+	"github.com/vizv/ipfilter/utils/format"
+	"github.com/vizv/ipfilter/utils/iprange"
+	"github.com/vizv/ipfilter/utils/logging"
+	"github.com/vizv/ipfilter/utils/metrics"
+)
+
+// serverShutdownTimeout limits the time to finish pending requests when the server is stopped.
+const serverShutdownTimeout = 5 * time.Second
+
+// serverFormat is an output format served at its path.
+type serverFormat struct {
+	path  string
+	write func(w io.Writer, slotPath string, intervals func() iprange.Intervals) error
+}
+
+var serverFormats = []serverFormat{
+	{"/ipfilter.dat", func(w io.Writer, slotPath string, _ func() iprange.Intervals) error {
+		datBytes, err := os.ReadFile(slotPath)
+		if err != nil {
+			return err
+		}
+		_, err = w.Write(datBytes)
+		return err
+	}},
+	{"/blocklist.p2p", func(w io.Writer, _ string, intervals func() iprange.Intervals) error {
+		return format.WriteP2P(w, intervals(), "ipfilter")
+	}},
+	{"/cidr.txt", func(w io.Writer, _ string, intervals func() iprange.Intervals) error {
+		return format.WriteCIDR(w, intervals())
+	}},
+}
+
+// rendered is the active slot rendered in a format, plain and gzip-encoded.
+type rendered struct {
+	plain []byte
+	gzip  []byte
+}
+
+// ServerState provides the slots and sources to serve, it is called on every request so settings reloaded by the sync
+// daemon are followed. Ready and Healthy return the reason if not ready or unhealthy.
+type ServerState interface {
+	Slots() (*Slots, error)
+	Sources() []*Source
+	Ready() error
+	Healthy() error
+}
+
+// StaticState is the server state of fixed settings, used by "ipfilter serve".
+type StaticState struct {
+	OutputDir   string
+	Generations int
+	SourceList  []*Source
+}
+
+func (s *StaticState) Slots() (*Slots, error) {
+	return OpenSlots(s.OutputDir, s.Generations)
+}
+
+func (s *StaticState) Sources() []*Source {
+	return s.SourceList
+}
+
+// Ready returns an error if no slot is active.
+func (s *StaticState) Ready() error {
+	slots, err := s.Slots()
+	if err != nil {
+		return fmt.Errorf("failed to open slots: %v", err)
+	}
+	if slots.Active() == nil {
+		return fmt.Errorf("no active slot")
+	}
+	return nil
+}
+
+// Healthy always returns nil, the served slot is only refreshed by "ipfilter sync".
+func (s *StaticState) Healthy() error {
+	return nil
+}
+
+// Server serves the active slot in every supported output format, so it can be used as upstream by other instances,
+// and a lookup API for the rules.
+type Server struct {
+	state ServerState
+	mux   *http.ServeMux
+
+	mu        sync.Mutex
+	hash      string
+	intervals iprange.Intervals
+	matcher   *iprange.Matcher
+	rendered  map[string]*rendered
+	indexes   map[string]*sourceIndex
+}
+
+// NewServer creates a server for the state.
+func NewServer(state ServerState) *Server {
+	s := &Server{state: state, mux: http.NewServeMux(), indexes: map[string]*sourceIndex{}}
+	for _, f := range serverFormats {
+		s.mux.HandleFunc("GET "+f.path, s.handleFormat(f))
+	}
+	s.mux.HandleFunc("GET /v1/check", s.handleCheck)
+	s.mux.HandleFunc("POST /v1/check", s.handleCheckBatch)
+	s.mux.HandleFunc("GET /v1/stats", s.handleStats)
+	s.mux.Handle("GET /metrics", metrics.Default)
+	s.mux.HandleFunc("GET /healthz", handleProbe(state.Healthy))
+	s.mux.HandleFunc("GET /readyz", handleProbe(state.Ready))
+	return s
+}
+
+func (s *Server) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	log.WithFields(log.Fields{"remote": r.RemoteAddr, "method": r.Method, "path": r.URL.Path}).Debugf("request received")
+	s.mux.ServeHTTP(w, r)
+}
+
+// ListenAndServe serves on the address until the context is cancelled.
+func (s *Server) ListenAndServe(ctx context.Context, addr string) error {
+	server := &http.Server{Addr: addr, Handler: s}
+	go func() {
+		<-ctx.Done()
+		shutdownCtx, cancel := context.WithTimeout(context.Background(), serverShutdownTimeout)
+		defer cancel()
+		server.Shutdown(shutdownCtx)
+	}()
+
+	log.WithField("listen", addr).Infof("serving active slot...")
+	if err := server.ListenAndServe(); err != nil && !errors.Is(err, http.ErrServerClosed) {
+		return fmt.Errorf("error serving on %s: %v", addr, err)
+	}
+	return nil
+}
+
+func (s *Server) handleFormat(f serverFormat) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		slots, err := s.state.Slots()
+		if err != nil {
+			http.Error(w, fmt.Sprintf("failed to open slots: %v", err), http.StatusInternalServerError)
+			return
+		}
+		active := slots.Active()
+		if active == nil {
+			http.Error(w, "no active slot", http.StatusServiceUnavailable)
+			return
+		}
+		slotPath, err := slots.Path(active.Slot)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+
+		content, err := s.render(f, slotPath, active.Hash)
+		if err != nil {
+			log.WithFields(log.Fields{logging.FieldSlot: active.Slot, "path": f.path}).Warnf("failed to render: %v", err)
+			http.Error(w, "failed to render active slot", http.StatusInternalServerError)
+			return
+		}
+
+		modTime := slots.SwitchedAt()
+		if info, err := os.Stat(slotPath); modTime.IsZero() && err == nil {
+			modTime = info.ModTime()
+		}
+
+		body, etag := content.plain, active.Hash+"-"+strings.TrimPrefix(f.path, "/")
+		w.Header().Set("Vary", "Accept-Encoding")
+		if acceptsGzip(r) {
+			body, etag = content.gzip, etag+".gz"
+			w.Header().Set("Content-Encoding", "gzip")
+		}
+		w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+		w.Header().Set("ETag", `"`+etag+`"`)
+		http.ServeContent(w, r, f.path, modTime, bytes.NewReader(body))
+	}
+}
+
+// render returns the active slot in the format, rendered once for each active slot.
+func (s *Server) render(f serverFormat, slotPath, hash string) (*rendered, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.switchHash(hash)
+	if content, ok := s.rendered[f.path]; ok {
+		return content, nil
+	}
+
+	intervals := func() iprange.Intervals {
+		return s.loadIntervals(slotPath)
+	}
+	plain := bytes.Buffer{}
+	if err := f.write(&plain, slotPath, intervals); err != nil {
+		return nil, err
+	}
+
+	compressed := bytes.Buffer{}
+	gz := gzip.NewWriter(&compressed)
+	if _, err := gz.Write(plain.Bytes()); err != nil {
+		return nil, err
+	}
+	if err := gz.Close(); err != nil {
+		return nil, err
+	}
+
+	content := &rendered{plain.Bytes(), compressed.Bytes()}
+	s.rendered[f.path] = content
+	return content, nil
+}
+
+// switchHash drops everything rendered from the previous active slot, the lock must be held.
+func (s *Server) switchHash(hash string) {
+	if s.hash != hash {
+		s.hash, s.intervals, s.matcher, s.rendered = hash, nil, nil, map[string]*rendered{}
+	}
+}
+
+// loadIntervals returns the intervals of the active slot, loaded once for each active slot. The lock must be held.
+func (s *Server) loadIntervals(slotPath string) iprange.Intervals {
+	if s.intervals == nil {
+		s.intervals, _ = LoadIntervals(slotPath)
+	}
+	return s.intervals
+}
+
+// handleProbe responds "ok", or 503 with the reason returned by the check.
+func handleProbe(check func() error) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Cache-Control", "no-store")
+		if err := check(); err != nil {
+			http.Error(w, err.Error(), http.StatusServiceUnavailable)
+			return
+		}
+		w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+		fmt.Fprintln(w, "ok")
+	}
+}
+
+func acceptsGzip(r *http.Request) bool {
+	for _, encoding := range strings.Split(r.Header.Get("Accept-Encoding"), ",") {
+		name, params, _ := strings.Cut(strings.TrimSpace(encoding), ";")
+		if strings.EqualFold(strings.TrimSpace(name), "gzip") && strings.ReplaceAll(params, " ", "") != "q=0" {
+			return true
+		}
+	}
+	return false
+}
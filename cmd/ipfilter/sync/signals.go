@@ -0,0 +1,56 @@
+package sync
+
+import (
+	"context"
+	"os"
+	"os/signal"
+	"slices"
+	"syscall"
+
+	log "github.com/sirupsen/logrus"
+)
+
+var shutdownSignals = []os.Signal{os.Interrupt, syscall.SIGTERM}
+
+// HandleSignals handles signals for the daemon until the returned function is called:
+// shutdown signals cancel the context (a second one exits immediately), reload signals send to the reload channel,
+// and status signals dump the daemon status.
+func (d *Daemon) HandleSignals(cancel context.CancelFunc, reload chan<- struct{}) func() {
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, slices.Concat(shutdownSignals, reloadSignals, statusSignals)...)
+
+	done := make(chan struct{})
+	go func() {
+		shuttingDown := false
+		for {
+			select {
+			case <-done:
+				return
+			case sig := <-signals:
+				switch {
+				case slices.Contains(shutdownSignals, sig):
+					if shuttingDown {
+						log.Warnf("received %s again, exiting immediately.", sig)
+						os.Exit(1)
+					}
+					log.Infof("received %s, shutting down...", sig)
+					shuttingDown = true
+					cancel()
+				case slices.Contains(reloadSignals, sig):
+					log.Infof("received %s, reloading...", sig)
+					select {
+					case reload <- struct{}{}:
+					default:
+					}
+				case slices.Contains(statusSignals, sig):
+					d.LogStatus()
+				}
+			}
+		}
+	}()
+
+	return func() {
+		signal.Stop(signals)
+		close(done)
+	}
+}
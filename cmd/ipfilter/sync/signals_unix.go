@@ -0,0 +1,11 @@
+//go:build !windows
+
+package sync
+
+import (
+	"os"
+	"syscall"
+)
+
+var reloadSignals = []os.Signal{syscall.SIGHUP}
+var statusSignals = []os.Signal{syscall.SIGUSR1}
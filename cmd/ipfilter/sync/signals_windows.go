@@ -0,0 +1,9 @@
+//go:build windows
+
+package sync
+
+import "os"
+
+// reload and status signals are not available on Windows.
+var reloadSignals = []os.Signal{}
+var statusSignals = []os.Signal{}
@@ -1,25 +1,241 @@
 package sync
 
-import "os"
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+
+	"github.com/vizv/ipfilter/utils/files"
+	"github.com/vizv/ipfilter/utils/hash"
+	"github.com/vizv/ipfilter/utils/logging"
+)
 
 const (
-	slotAFile = "ipfilter-a.dat"
-	slotBFile = "ipfilter-b.dat"
+	stateFile = "ipfilter-state.json"
+
+	MinGenerations = 2
+	MaxGenerations = 26
 )
 
-func GetSlotFiles() (string, string) {
-	slotAStat, err := os.Stat(slotAFile)
+// Generation is the content of a slot file written at some point.
+type Generation struct {
+	Slot      string    `json:"slot"`
+	Hash      string    `json:"hash"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// State records the active slot and the generations kept in the output directory.
+type State struct {
+	ActiveSlot  string       `json:"active_slot"`
+	SwitchedAt  time.Time    `json:"switched_at"`
+	Pinned      bool         `json:"pinned"`
+	Generations []Generation `json:"generations"`
+}
+
+// Slots manages the slot files ipfilter-a.dat, ipfilter-b.dat... in the output directory. Each slot keeps one
+// generation of the merged ipfilter.dat, the oldest inactive slot is overwritten by the next generation.
+type Slots struct {
+	dir       string
+	count     int
+	state     State
+	recovered bool
+}
+
+// SlotFile returns the slot file name for the given slot index, e.g. "ipfilter-a.dat" for 0.
+func SlotFile(index int) string {
+	return fmt.Sprintf("ipfilter-%c.dat", 'a'+index)
+}
+
+// OpenSlots loads slot state from the output directory, count is the number of generations to keep.
+// Without a state file, generations are recovered from existing slot files and the newest one is considered active.
+func OpenSlots(dir string, count int) (*Slots, error) {
+	if count < MinGenerations || count > MaxGenerations {
+		return nil, fmt.Errorf("invalid generations %d, must be between %d and %d", count, MinGenerations, MaxGenerations)
+	}
+	s := &Slots{dir: dir, count: count}
+
+	stateBytes, err := os.ReadFile(filepath.Join(dir, stateFile))
+	if err != nil && !errors.Is(err, os.ErrNotExist) {
+		return nil, fmt.Errorf("failed to read state: %v", err)
+	}
+	if err == nil {
+		if err := json.Unmarshal(stateBytes, &s.state); err != nil {
+			return nil, fmt.Errorf("failed to parse state: %v", err)
+		}
+	}
+
+	if len(s.state.Generations) == 0 {
+		s.recover()
+	}
+
+	return s, nil
+}
+
+// recover rebuilds generations from existing slot files.
+func (s *Slots) recover() {
+	s.recovered = true
+
+	for i := 0; i < MaxGenerations; i++ {
+		slot := SlotFile(i)
+		slotPath := filepath.Join(s.dir, slot)
+		slotStat, err := os.Stat(slotPath)
+		if err != nil {
+			continue
+		}
+		slotBytes, err := os.ReadFile(slotPath)
+		if err != nil {
+			log.WithFields(log.Fields{logging.FieldSlot: slot, "path": slotPath}).Warnf("failed to read slot file: %v, skipping...", err)
+			continue
+		}
+		s.state.Generations = append(s.state.Generations, Generation{slot, hash.CalculateMD5(slotBytes), slotStat.ModTime()})
+	}
+
+	if s.state.ActiveSlot == "" {
+		if generations := s.Generations(); len(generations) > 0 {
+			s.state.ActiveSlot = generations[0].Slot
+			s.state.SwitchedAt = generations[0].CreatedAt
+		}
+	}
+}
+
+// ActiveSlotPath returns the absolute path of the active slot in the output directory.
+func ActiveSlotPath(outputDir string, count int) (string, error) {
+	slots, err := OpenSlots(outputDir, count)
 	if err != nil {
-		return slotAFile, slotBFile
+		return "", fmt.Errorf("failed to open slots: %v", err)
+	}
+
+	active := slots.Active()
+	if active == nil {
+		return "", fmt.Errorf(`no active slot in "%s"`, outputDir)
+	}
+	return slots.Path(active.Slot)
+}
+
+// Recovered reports whether the state is recovered from slot files, and the active slot is only a guess.
+func (s *Slots) Recovered() bool {
+	return s.recovered
+}
+
+func (s *Slots) Dir() string {
+	return s.dir
+}
+
+// Path returns the absolute path of the slot file.
+func (s *Slots) Path(slot string) (string, error) {
+	return filepath.Abs(filepath.Join(s.dir, slot))
+}
+
+// Active returns the active generation, or nil if no generation is active.
+func (s *Slots) Active() *Generation {
+	for _, generation := range s.state.Generations {
+		if generation.Slot == s.state.ActiveSlot {
+			return &generation
+		}
 	}
-	slotBStat, err := os.Stat(slotBFile)
+	return nil
+}
+
+func (s *Slots) SwitchedAt() time.Time {
+	return s.state.SwitchedAt
+}
+
+// Generations returns all kept generations from the newest to the oldest.
+func (s *Slots) Generations() []Generation {
+	generations := slices.Clone(s.state.Generations)
+	slices.SortStableFunc(generations, func(a, b Generation) int {
+		return b.CreatedAt.Compare(a.CreatedAt)
+	})
+	return generations
+}
+
+// Previous returns the index in Generations of the newest generation older than the active one.
+func (s *Slots) Previous() (int, bool) {
+	active := s.Active()
+	if active == nil {
+		return 0, false
+	}
+
+	for i, generation := range s.Generations() {
+		if generation.CreatedAt.Before(active.CreatedAt) {
+			return i, true
+		}
+	}
+	return 0, false
+}
+
+// Next returns the slot to write the next generation to: an unused slot, or the slot with the oldest generation.
+// The active slot and excluded slots are never returned.
+func (s *Slots) Next(exclude ...string) string {
+	next, nextCreatedAt := "", time.Time{}
+	for i := 0; i < s.count; i++ {
+		slot := SlotFile(i)
+		if slot == s.state.ActiveSlot || slices.Contains(exclude, slot) {
+			continue
+		}
+
+		createdAt := time.Time{}
+		for _, generation := range s.state.Generations {
+			if generation.Slot == slot {
+				createdAt = generation.CreatedAt
+			}
+		}
+		if next == "" || createdAt.Before(nextCreatedAt) {
+			next, nextCreatedAt = slot, createdAt
+		}
+	}
+	return next
+}
+
+// Write writes a new generation to the slot atomically and records it in the state file.
+func (s *Slots) Write(slot string, data []byte) error {
+	slotPath := filepath.Join(s.dir, slot)
+	if err := files.WriteFileAtomic(slotPath, data, 0o644); err != nil {
+		return fmt.Errorf(`failed to write slot "%s": %v`, slotPath, err)
+	}
+
+	generations := slices.DeleteFunc(s.state.Generations, func(generation Generation) bool {
+		return generation.Slot == slot
+	})
+	s.state.Generations = append(generations, Generation{slot, hash.CalculateMD5(data), time.Now()})
+
+	return s.save()
+}
+
+// Activate records the slot as active in the state file.
+func (s *Slots) Activate(slot string) error {
+	s.state.ActiveSlot = slot
+	s.state.SwitchedAt = time.Now()
+
+	return s.save()
+}
+
+// Pinned reports whether the active slot is pinned, the sync daemon does not switch slots while pinned.
+func (s *Slots) Pinned() bool {
+	return s.state.Pinned
+}
+
+// Pin pins or unpins the active slot and records it in the state file.
+func (s *Slots) Pin(pinned bool) error {
+	s.state.Pinned = pinned
+
+	return s.save()
+}
+
+func (s *Slots) save() error {
+	stateBytes, err := json.MarshalIndent(s.state, "", "  ")
 	if err != nil {
-		return slotBFile, slotAFile
+		return fmt.Errorf("failed to encode state: %v", err)
 	}
 
-	if slotAStat.ModTime().Before(slotBStat.ModTime()) {
-		return slotAFile, slotBFile
-	} else {
-		return slotBFile, slotAFile
+	if err := files.WriteFileAtomic(filepath.Join(s.dir, stateFile), stateBytes, 0o644); err != nil {
+		return fmt.Errorf("failed to save state: %v", err)
 	}
+	return nil
 }
@@ -0,0 +1,145 @@
+package sync
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestSlotsNext(t *testing.T) {
+	base := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	tests := []struct {
+		name        string
+		count       int
+		active      string
+		generations []Generation
+		exclude     []string
+		want        string
+	}{
+		{"empty", 2, "", nil, nil, "ipfilter-a.dat"},
+		{"unused slot first", 3, "ipfilter-a.dat", []Generation{
+			{"ipfilter-a.dat", "a", base.Add(2 * time.Hour)},
+			{"ipfilter-b.dat", "b", base},
+		}, nil, "ipfilter-c.dat"},
+		{"oldest inactive", 3, "ipfilter-b.dat", []Generation{
+			{"ipfilter-a.dat", "a", base.Add(time.Hour)},
+			{"ipfilter-b.dat", "b", base.Add(2 * time.Hour)},
+			{"ipfilter-c.dat", "c", base},
+		}, nil, "ipfilter-c.dat"},
+		{"never the active slot", 2, "ipfilter-a.dat", []Generation{
+			{"ipfilter-a.dat", "a", base},
+			{"ipfilter-b.dat", "b", base.Add(time.Hour)},
+		}, nil, "ipfilter-b.dat"},
+		{"excluded slots", 3, "ipfilter-b.dat", []Generation{
+			{"ipfilter-a.dat", "a", base.Add(time.Hour)},
+			{"ipfilter-b.dat", "b", base.Add(2 * time.Hour)},
+			{"ipfilter-c.dat", "c", base},
+		}, []string{"ipfilter-c.dat"}, "ipfilter-a.dat"},
+		{"all excluded", 2, "ipfilter-a.dat", nil, []string{"ipfilter-b.dat"}, ""},
+		{"slots beyond count ignored", 2, "ipfilter-a.dat", []Generation{
+			{"ipfilter-a.dat", "a", base.Add(time.Hour)},
+			{"ipfilter-b.dat", "b", base.Add(2 * time.Hour)},
+			{"ipfilter-c.dat", "c", base},
+		}, nil, "ipfilter-b.dat"},
+	}
+	for _, test := range tests {
+		slots := &Slots{count: test.count, state: State{ActiveSlot: test.active, Generations: test.generations}}
+		if got := slots.Next(test.exclude...); got != test.want {
+			t.Errorf("Next(%s) = %q, want %q", test.name, got, test.want)
+		}
+	}
+}
+
+func TestOpenSlotsRecover(t *testing.T) {
+	dir := t.TempDir()
+	base := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	slotFiles := []struct {
+		slot    string
+		modTime time.Time
+	}{
+		{"ipfilter-a.dat", base},
+		{"ipfilter-b.dat", base.Add(time.Hour)},
+		{"ipfilter-d.dat", base.Add(30 * time.Minute)},
+	}
+	for _, slotFile := range slotFiles {
+		slotPath := filepath.Join(dir, slotFile.slot)
+		if err := os.WriteFile(slotPath, []byte(slotFile.slot), 0o644); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.Chtimes(slotPath, slotFile.modTime, slotFile.modTime); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	slots, err := OpenSlots(dir, 4)
+	if err != nil {
+		t.Fatalf("OpenSlots() error: %v", err)
+	}
+	if !slots.Recovered() {
+		t.Errorf("Recovered() = false, want true without state file")
+	}
+	active := slots.Active()
+	if active == nil || active.Slot != "ipfilter-b.dat" {
+		t.Fatalf("Active() = %+v, want the newest slot ipfilter-b.dat", active)
+	}
+	if !slots.SwitchedAt().Equal(base.Add(time.Hour)) {
+		t.Errorf("SwitchedAt() = %s, want %s", slots.SwitchedAt(), base.Add(time.Hour))
+	}
+
+	want := []string{"ipfilter-b.dat", "ipfilter-d.dat", "ipfilter-a.dat"}
+	generations := slots.Generations()
+	if len(generations) != len(want) {
+		t.Fatalf("Generations() = %+v, want slots %v", generations, want)
+	}
+	for i, generation := range generations {
+		if generation.Slot != want[i] {
+			t.Errorf("Generations()[%d] = %q, want %q", i, generation.Slot, want[i])
+		}
+	}
+	if previous, ok := slots.Previous(); !ok || generations[previous].Slot != "ipfilter-d.dat" {
+		t.Errorf("Previous() = %d, %v, want ipfilter-d.dat", previous, ok)
+	}
+	if got := slots.Next(); got != "ipfilter-c.dat" {
+		t.Errorf("Next() = %q, want unused ipfilter-c.dat", got)
+	}
+}
+
+func TestOpenSlotsState(t *testing.T) {
+	dir := t.TempDir()
+	slots, err := OpenSlots(dir, 2)
+	if err != nil {
+		t.Fatalf("OpenSlots() error: %v", err)
+	}
+	if slots.Active() != nil {
+		t.Fatalf("Active() = %+v, want nil in an empty directory", slots.Active())
+	}
+
+	next := slots.Next()
+	if err := slots.Write(next, []byte("first")); err != nil {
+		t.Fatalf("Write() error: %v", err)
+	}
+	if err := slots.Activate(next); err != nil {
+		t.Fatalf("Activate() error: %v", err)
+	}
+
+	reopened, err := OpenSlots(dir, 2)
+	if err != nil {
+		t.Fatalf("OpenSlots() error: %v", err)
+	}
+	if reopened.Recovered() {
+		t.Errorf("Recovered() = true, want state file loaded")
+	}
+	if active := reopened.Active(); active == nil || active.Slot != next {
+		t.Errorf("Active() = %+v, want %q", active, next)
+	}
+	if got := reopened.Next(); got == next || got == "" {
+		t.Errorf("Next() = %q, want another slot than the active %q", got, next)
+	}
+
+	for _, count := range []int{MinGenerations - 1, MaxGenerations + 1} {
+		if _, err := OpenSlots(dir, count); err == nil {
+			t.Errorf("OpenSlots(%d) error = nil, want error", count)
+		}
+	}
+}
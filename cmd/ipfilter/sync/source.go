@@ -0,0 +1,165 @@
+package sync
+
+import (
+	"fmt"
+	"net/url"
+	"path"
+	"strings"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+	"github.com/vizv/ipfilter/utils/hash"
+	"github.com/vizv/ipfilter/utils/logging"
+)
+
+// sourceIntervalSeparator separates an optional refresh interval or cron expression from the URL,
+// e.g. "https://example.com/ipfilter.dat|1h" or "https://example.com/ipfilter.dat|10 4 * * *".
+const sourceIntervalSeparator = "|"
+
+type Source struct {
+	URL       string
+	CachePath string
+	Schedule  Schedule
+	LastRun   time.Time
+	NextRun   time.Time
+	FirstRun  time.Time
+
+	LastSuccess time.Time
+	LastUpdate  time.Time
+	LastError   error
+}
+
+// Redacted returns the URL with its password replaced by "xxxxx", to be published in logs, metrics and the API.
+func (s *Source) Redacted() string {
+	return redactURL(s.URL)
+}
+
+// redactURL redacts the password of the URL, the userinfo of an unparsable URL is redacted as a whole.
+func redactURL(rawURL string) string {
+	parsedURL, err := url.Parse(rawURL)
+	if err != nil {
+		if i := strings.LastIndex(rawURL, "@"); i >= 0 {
+			scheme, _, _ := strings.Cut(rawURL, "://")
+			return scheme + "://xxxxx" + rawURL[i:]
+		}
+		return rawURL
+	}
+	return parsedURL.Redacted()
+}
+
+// Sources parses raw source entries, each entry is an URL optionally followed by "|INTERVAL".
+// Sources without their own interval use the default schedule.
+func Sources(entries []string, cacheDir string, defaultSchedule Schedule) []*Source {
+	sources := []*Source{}
+	seen := map[string]bool{}
+	for _, entry := range entries {
+		entry = strings.TrimSpace(entry)
+		if entry == "" {
+			continue
+		}
+
+		datURL, rawInterval, hasInterval := strings.Cut(entry, sourceIntervalSeparator)
+		datURL = strings.TrimSpace(datURL)
+		if _, err := url.ParseRequestURI(datURL); err != nil {
+			log.WithField(logging.FieldURL, redactURL(datURL)).Warnf("ignore invalid filter.dat URL")
+			continue
+		}
+		if seen[datURL] {
+			log.WithField(logging.FieldURL, redactURL(datURL)).Warnf("ignore duplicated filter.dat URL")
+			continue
+		}
+		seen[datURL] = true
+
+		schedule := defaultSchedule
+		if hasInterval {
+			parsed, err := ParseSchedule(strings.TrimSpace(rawInterval))
+			if err != nil {
+				log.WithFields(log.Fields{logging.FieldURL: redactURL(datURL), "interval": rawInterval}).Warnf("failed to parse source interval: %v, use default interval - %s", err, defaultSchedule)
+			} else {
+				schedule = parsed
+			}
+		}
+
+		cacheFilename := fmt.Sprintf("ipfilter-%s.dat", hash.CalculateMD5([]byte(datURL)))
+		sources = append(sources, &Source{
+			URL:       datURL,
+			CachePath: path.Join(cacheDir, cacheFilename),
+			Schedule:  schedule,
+		})
+	}
+
+	return sources
+}
+
+// Due reports whether the source should be downloaded at the given time.
+// A source is always due before its first run, and never due again once its schedule has no next run.
+func (s *Source) Due(now time.Time) bool {
+	if s.LastRun.IsZero() {
+		return true
+	}
+	if s.NextRun.IsZero() {
+		return false
+	}
+	return !now.Before(s.NextRun)
+}
+
+// LastRefresh returns the time of the last successful download, or of the first attempt if the source was never
+// downloaded. It is zero before the first attempt.
+func (s *Source) LastRefresh() time.Time {
+	if !s.LastSuccess.IsZero() {
+		return s.LastSuccess
+	}
+	return s.FirstRun
+}
+
+// Reschedule records a download attempt at the given time and computes the next run.
+func (s *Source) Reschedule(now time.Time) {
+	if s.FirstRun.IsZero() {
+		s.FirstRun = now
+	}
+	s.LastRun = now
+	s.NextRun = s.Schedule.Next(now)
+}
+
+type Scheduler struct {
+	Sources []*Source
+}
+
+// Due returns sources should be downloaded at the given time.
+func (s *Scheduler) Due(now time.Time) []*Source {
+	due := []*Source{}
+	for _, source := range s.Sources {
+		if source.Due(now) {
+			due = append(due, source)
+		}
+	}
+	return due
+}
+
+// Next returns the earliest time any source becomes due, false if no source will be due again.
+func (s *Scheduler) Next() (time.Time, bool) {
+	next, found := time.Time{}, false
+	for _, source := range s.Sources {
+		if !source.LastRun.IsZero() && source.NextRun.IsZero() {
+			continue
+		}
+		if !found || source.NextRun.Before(next) {
+			next, found = source.NextRun, true
+		}
+	}
+	return next, found
+}
+
+// Keep copies the state of the sources to the new sources with the same URL and schedule, so they are not downloaded
+// again before they are due.
+func (s *Scheduler) Keep(sources []*Source) {
+	for _, source := range sources {
+		for _, old := range s.Sources {
+			if old.URL != source.URL || old.Schedule.String() != source.Schedule.String() {
+				continue
+			}
+			source.LastRun, source.NextRun, source.FirstRun = old.LastRun, old.NextRun, old.FirstRun
+			source.LastSuccess, source.LastUpdate, source.LastError = old.LastSuccess, old.LastUpdate, old.LastError
+		}
+	}
+}
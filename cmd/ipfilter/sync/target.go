@@ -0,0 +1,183 @@
+package sync
+
+import (
+	"context"
+	"fmt"
+	"net/url"
+	"strings"
+	"sync"
+
+	log "github.com/sirupsen/logrus"
+
+	"github.com/vizv/ipfilter/utils/logging"
+	"github.com/vizv/ipfilter/utils/qb"
+)
+
+// Target is a qBittorrent WebUI to notify when slots are switched.
+type Target struct {
+	Name     string
+	WebUIURL *url.URL
+
+	// PathMap maps paths sent to and read from qBittorrent, e.g. for qBittorrent in a container.
+	PathMap PathMap
+
+	mu       sync.Mutex
+	client   *qb.Client
+	prefPath string
+}
+
+// ClientPath maps the host path to the path seen by qBittorrent.
+func (t *Target) ClientPath(hostPath string) string {
+	return t.PathMap.ToClient(hostPath)
+}
+
+// HostPath returns the host path of the ip_filter_path qBittorrent currently loads, or empty if not connected.
+func (t *Target) HostPath() string {
+	connected, prefPath := t.Status()
+	if !connected || prefPath == "" {
+		return ""
+	}
+	return t.PathMap.ToHost(prefPath)
+}
+
+func (t *Target) logger() *log.Entry {
+	return log.WithFields(log.Fields{"target": t.Name, logging.FieldURL: t.WebUIURL.Redacted()})
+}
+
+// Connect creates the qBittorrent client and gets the current ip_filter_path.
+func (t *Target) Connect() error {
+	client, err := qb.NewClient(t.WebUIURL)
+	if err != nil {
+		return fmt.Errorf("failed to create qBittorrent client: %v", err)
+	}
+
+	prefs, err := client.GetPreferences()
+	if err != nil {
+		return fmt.Errorf("failed to get preferences from qBittorrent client: %v", err)
+	}
+	t.logger().Infof("Current Preferences: ip_filter_enabled = %t, ip_filter_path = %s (%s on host)", prefs.IPFilterEnabled, prefs.IPFilterPath, t.PathMap.ToHost(prefs.IPFilterPath))
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.client = client
+	t.prefPath = prefs.IPFilterPath
+	return nil
+}
+
+// Status returns whether the target is connected, and the last known ip_filter_path.
+func (t *Target) Status() (bool, string) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return t.client != nil, t.prefPath
+}
+
+// Uses reports whether qBittorrent currently loads the host path.
+func (t *Target) Uses(hostPath string) bool {
+	currentPath := t.HostPath()
+	return currentPath != "" && SamePath(currentPath, hostPath)
+}
+
+// Client returns the qBittorrent client, connecting first if not connected yet.
+func (t *Target) Client() (*qb.Client, error) {
+	if connected, _ := t.Status(); !connected {
+		if err := t.Connect(); err != nil {
+			return nil, err
+		}
+	}
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return t.client, nil
+}
+
+// Poll gets the current ip_filter_path, connecting first if not connected yet. The last known ip_filter_path is
+// forgotten if qBittorrent is unreachable.
+func (t *Target) Poll() error {
+	client, err := t.Client()
+	var prefs *qb.Preferences
+	if err == nil {
+		prefs, err = client.GetPreferences()
+	}
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if err != nil {
+		t.prefPath = ""
+		return fmt.Errorf("failed to get preferences from qBittorrent client: %v", err)
+	}
+	t.prefPath = prefs.IPFilterPath
+	return nil
+}
+
+// Refresh points qBittorrent to the host path, connecting first if not connected yet.
+func (t *Target) Refresh(hostPath string) error {
+	client, err := t.Client()
+	if err != nil {
+		return err
+	}
+
+	clientPath := t.ClientPath(hostPath)
+	if err := client.RefreshIPFilter(clientPath); err != nil {
+		return fmt.Errorf("error refreshing IP filter: %v", err)
+	}
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.prefPath = clientPath
+	return nil
+}
+
+func (t *Target) Section() string {
+	if t.Name == "default" {
+		return "sync"
+	}
+	return "qbittorrent." + t.Name
+}
+
+// Notify points qBittorrent to the active slot if it is not loading it, e.g. failed to switch previously.
+func (t *Target) Notify(ctx context.Context, event *Event) error {
+	if event.Mode != ModeFilter || event.ActivePath == "" || t.Uses(event.ActivePath) {
+		return nil
+	}
+
+	t.logger().Infof(`switching outdated qBittorrent target to "%s"...`, event.ActivePath)
+	err := t.Refresh(event.ActivePath)
+	metricQBittorrentNotify.Inc(t.Section(), resultLabel(err))
+	if err != nil {
+		return err
+	}
+	t.logger().Infof("slot switched to %s", t.ClientPath(event.ActivePath))
+	return nil
+}
+
+// ConnectTargets connects all targets, targets failed to connect are kept and connected again on refresh.
+func ConnectTargets(targets []*Target) {
+	for _, target := range targets {
+		if err := target.Connect(); err != nil {
+			target.logger().Warnf("%v, will retry on next switch.", err)
+		}
+	}
+}
+
+// RefreshTargets points all targets to the host path, and returns the number of succeeded targets, and an error
+// describing failed targets if any.
+func RefreshTargets(targets []*Target, hostPath string) (int, error) {
+	succeeded := 0
+	failed := []string{}
+	for _, target := range targets {
+		err := target.Refresh(hostPath)
+		metricQBittorrentNotify.Inc(target.Section(), resultLabel(err))
+		if err != nil {
+			target.logger().Warnf("failed to switch slot: %v", err)
+			failed = append(failed, target.Name)
+			continue
+		}
+		target.logger().Infof("slot switched to %s", target.ClientPath(hostPath))
+		succeeded += 1
+	}
+
+	if len(failed) > 0 {
+		return succeeded, fmt.Errorf("failed to switch slot on %d of %d qBittorrent targets: %s", len(failed), len(targets), strings.Join(failed, ", "))
+	}
+	return succeeded, nil
+}
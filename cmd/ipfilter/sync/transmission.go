@@ -0,0 +1,86 @@
+package sync
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"net/url"
+	"path/filepath"
+
+	log "github.com/sirupsen/logrus"
+
+	"github.com/vizv/ipfilter/utils/files"
+	"github.com/vizv/ipfilter/utils/format"
+	"github.com/vizv/ipfilter/utils/logging"
+	"github.com/vizv/ipfilter/utils/transmission"
+)
+
+// transmissionBlocklistFile is the P2P blocklist written to the blocklist directory, loaded by Transmission from its
+// file:// URL.
+const transmissionBlocklistFile = "ipfilter.p2p"
+
+// TransmissionTarget is a Transmission daemon to update blocklist when slots are switched.
+type TransmissionTarget struct {
+	Name   string
+	RPCURL *url.URL
+
+	// BlocklistDir is the directory to write the blocklist to, readable by Transmission. It must not be the blocklists
+	// directory in Transmission config, as Transmission also loads every file there on startup besides blocklist-url.
+	BlocklistDir string
+	// PathMap maps the blocklist path to the path seen by Transmission, e.g. for Transmission in a container.
+	PathMap PathMap
+
+	client   *transmission.Client
+	lastHash string
+}
+
+func (t *TransmissionTarget) logger() *log.Entry {
+	return log.WithFields(log.Fields{"target": t.Name, logging.FieldURL: t.RPCURL.Redacted()})
+}
+
+// Update writes the IPv4 rules of the active slot as P2P blocklist, and sets it as the blocklist-url of Transmission
+// with a file:// URL, so Transmission replaces its blocklist with it.
+func (t *TransmissionTarget) Update(activePath, activeHash string) error {
+	if activeHash == t.lastHash {
+		return nil
+	}
+
+	intervals, _ := LoadIntervals(activePath)
+	blocklist := bytes.Buffer{}
+	if err := format.WriteP2P(&blocklist, intervals, "ipfilter"); err != nil {
+		return fmt.Errorf("failed to convert blocklist: %v", err)
+	}
+
+	blocklistPath, err := filepath.Abs(filepath.Join(t.BlocklistDir, transmissionBlocklistFile))
+	if err != nil {
+		return fmt.Errorf("error getting absolute path for blocklist: %v", err)
+	}
+	if err := files.WriteFileAtomic(blocklistPath, blocklist.Bytes(), 0o644); err != nil {
+		return fmt.Errorf("failed to save blocklist: %v", err)
+	}
+
+	if t.client == nil {
+		t.client = transmission.NewClient(t.RPCURL)
+	}
+	blocklistURL := (&url.URL{Scheme: "file", Path: filepath.ToSlash(t.PathMap.ToClient(blocklistPath))}).String()
+	size, err := t.client.RefreshBlocklist(blocklistURL)
+	if err != nil {
+		return fmt.Errorf("error refreshing blocklist: %v", err)
+	}
+
+	t.lastHash = activeHash
+	t.logger().Infof("blocklist updated from %s, %d rules loaded.", blocklistURL, size)
+	return nil
+}
+
+func (t *TransmissionTarget) Section() string {
+	return "transmission." + t.Name
+}
+
+// Notify updates the blocklist to the active slot.
+func (t *TransmissionTarget) Notify(ctx context.Context, event *Event) error {
+	if event.ActivePath == "" {
+		return nil
+	}
+	return t.Update(event.ActivePath, event.ActiveHash)
+}
@@ -0,0 +1,28 @@
+package sync
+
+import (
+	"github.com/fsnotify/fsnotify"
+	log "github.com/sirupsen/logrus"
+	"github.com/spf13/viper"
+
+	"github.com/vizv/ipfilter/utils/logging"
+)
+
+// WatchConfig watches the config file, changes are validated and applied at the start of the next cycle.
+func (d *Daemon) WatchConfig() {
+	configFile := viper.ConfigFileUsed()
+	if configFile == "" {
+		return
+	}
+
+	// watch with a separate instance, so the current settings are kept until the changes are validated
+	watcher := viper.New()
+	watcher.SetConfigFile(configFile)
+	watcher.OnConfigChange(func(event fsnotify.Event) {
+		if !d.configChanged.Swap(true) {
+			log.WithField(logging.FieldFile, event.Name).Infof("config file changed, will reload at the start of the next cycle.")
+		}
+	})
+	watcher.WatchConfig()
+	log.WithField(logging.FieldFile, configFile).Debugf("watching config file")
+}
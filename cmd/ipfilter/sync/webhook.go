@@ -0,0 +1,70 @@
+package sync
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+
+	"github.com/vizv/ipfilter/utils/logging"
+)
+
+// WebhookNotifier posts every event as JSON to an HTTP endpoint.
+type WebhookNotifier struct {
+	Name    string
+	URL     *url.URL
+	Timeout time.Duration
+
+	lastHash string
+}
+
+func (w *WebhookNotifier) Section() string {
+	return "webhook." + w.Name
+}
+
+func (w *WebhookNotifier) logger() *log.Entry {
+	return log.WithFields(log.Fields{"notifier": w.Section(), logging.FieldURL: w.URL.Redacted()})
+}
+
+// Notify posts the event, successful events are skipped if the active filter is already posted.
+func (w *WebhookNotifier) Notify(ctx context.Context, event *Event) error {
+	if event.Status == EventSuccess && event.ActiveHash == w.lastHash {
+		return nil
+	}
+
+	body, err := json.Marshal(event)
+	if err != nil {
+		return fmt.Errorf("error encoding event: %v", err)
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, w.Timeout)
+	defer cancel()
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, w.URL.String(), bytes.NewReader(body))
+	if err != nil {
+		return fmt.Errorf("error creating request: %v", err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return fmt.Errorf("error posting event: %v", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		respBody, _ := io.ReadAll(io.LimitReader(resp.Body, 1024))
+		return fmt.Errorf("error posting event: %d - %s", resp.StatusCode, string(respBody))
+	}
+
+	if event.Status == EventSuccess {
+		w.lastHash = event.ActiveHash
+	}
+	w.logger().Infof("%s event posted.", event.Status)
+	return nil
+}
@@ -3,14 +3,13 @@ package main
 import (
 	"os"
 
-	"github.com/mattn/go-colorable"
-	"github.com/sirupsen/logrus"
 	"github.com/vizv/ipfilter/cmd"
+	"github.com/vizv/ipfilter/utils/logging"
 )
 
 func main() {
-	logrus.SetFormatter(&logrus.TextFormatter{ForceColors: true})
-	logrus.SetOutput(colorable.NewColorableStdout())
+	// until the log settings are read from flags and the config file
+	logging.Setup(logging.Options{Format: logging.FormatText})
 
 	err := cmd.RootCmd.Execute()
 	if err != nil {
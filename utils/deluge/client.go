@@ -0,0 +1,178 @@
+package deluge
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/cookiejar"
+	"net/url"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+)
+
+// errorNotAuthenticated is the error code Deluge Web returns when the session is expired.
+const errorNotAuthenticated = 1
+
+// DEFAULT_TIMEOUT limits every call to Deluge Web including the blocklist import, so an unresponsive Deluge does not
+// block the caller.
+const DEFAULT_TIMEOUT = 60 * time.Second
+
+// Client calls Deluge Web JSON-RPC API.
+type Client struct {
+	URL      string
+	password string
+	id       int
+	http.Client
+}
+
+type request struct {
+	Method string `json:"method"`
+	Params []any  `json:"params"`
+	ID     int    `json:"id"`
+}
+
+type responseError struct {
+	Message string `json:"message"`
+	Code    int    `json:"code"`
+}
+
+type response struct {
+	Result json.RawMessage `json:"result"`
+	Error  *responseError  `json:"error"`
+	ID     int             `json:"id"`
+}
+
+// NewClient creates a client for Deluge Web, e.g. http://localhost:8112, logging in with the password in the URL.
+func NewClient(webURL *url.URL) (*Client, error) {
+	jar, err := cookiejar.New(nil)
+	if err != nil {
+		return nil, fmt.Errorf("error creating cookie jar: %v", err)
+	}
+
+	password, _ := webURL.User.Password()
+	clientURL := *webURL
+	clientURL.User = nil
+	clientURL.Path = "/json"
+	client := &Client{URL: clientURL.String(), password: password, Client: http.Client{Jar: jar, Timeout: DEFAULT_TIMEOUT}}
+
+	if err := client.login(); err != nil {
+		return nil, err
+	}
+	return client, nil
+}
+
+func (c *Client) login() error {
+	loggedIn := false
+	if err := c.call("auth.login", []any{c.password}, &loggedIn); err != nil {
+		return fmt.Errorf("error logging in: %v", err)
+	}
+	if !loggedIn {
+		return fmt.Errorf("error logging in: wrong password")
+	}
+	return nil
+}
+
+func (c *Client) call(method string, params []any, result any) error {
+	if params == nil {
+		params = []any{}
+	}
+	c.id += 1
+	body, err := json.Marshal(request{method, params, c.id})
+	if err != nil {
+		return fmt.Errorf("error encoding %s request: %v", method, err)
+	}
+
+	resp, err := c.Post(c.URL, "application/json", bytes.NewReader(body))
+	if err != nil {
+		return fmt.Errorf("error calling %s: %v", method, err)
+	}
+	defer resp.Body.Close()
+
+	respBody, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return fmt.Errorf("error reading %s response: %v", method, err)
+	}
+	if resp.StatusCode != 200 {
+		return fmt.Errorf("error calling %s: %d - %s", method, resp.StatusCode, string(respBody))
+	}
+
+	rpcResp := response{}
+	if err := json.Unmarshal(respBody, &rpcResp); err != nil {
+		return fmt.Errorf("error parsing %s response: %v", method, err)
+	}
+	if rpcResp.Error != nil {
+		return &Error{method, rpcResp.Error.Code, rpcResp.Error.Message}
+	}
+	if result != nil {
+		if err := json.Unmarshal(rpcResp.Result, result); err != nil {
+			return fmt.Errorf("error parsing %s result: %v", method, err)
+		}
+	}
+
+	return nil
+}
+
+// Error is an error returned by Deluge Web.
+type Error struct {
+	Method  string
+	Code    int
+	Message string
+}
+
+func (e *Error) Error() string {
+	return fmt.Sprintf("error calling %s: %d - %s", e.Method, e.Code, e.Message)
+}
+
+// Call calls the method, and calls it once again after login if the session is expired.
+func (c *Client) Call(method string, params []any, result any) error {
+	err := c.call(method, params, result)
+	if rpcErr, ok := err.(*Error); !ok || rpcErr.Code != errorNotAuthenticated {
+		return err
+	}
+
+	log.Infof("session expired, performing login...")
+	if err := c.login(); err != nil {
+		return err
+	}
+	return c.call(method, params, result)
+}
+
+// ConnectDaemon connects Deluge Web to the first daemon host if not connected yet.
+func (c *Client) ConnectDaemon() error {
+	connected := false
+	if err := c.Call("web.connected", nil, &connected); err != nil {
+		return err
+	}
+	if connected {
+		return nil
+	}
+
+	// each host is [id, host, port, status]
+	hosts := [][]any{}
+	if err := c.Call("web.get_hosts", nil, &hosts); err != nil {
+		return err
+	}
+	if len(hosts) == 0 || len(hosts[0]) == 0 {
+		return fmt.Errorf("no Deluge daemon host configured in Deluge Web")
+	}
+
+	return c.Call("web.connect", []any{hosts[0][0]}, nil)
+}
+
+type blocklistConfig struct {
+	URL string `json:"url"`
+}
+
+// RefreshBlocklist sets the Blocklist plugin URL, which may be a local path, and forces the plugin to import it.
+func (c *Client) RefreshBlocklist(blocklistURL string) error {
+	if err := c.ConnectDaemon(); err != nil {
+		return fmt.Errorf("error connecting daemon: %v", err)
+	}
+	if err := c.Call("blocklist.set_config", []any{blocklistConfig{blocklistURL}}, nil); err != nil {
+		return err
+	}
+	return c.Call("blocklist.check_import", []any{true}, nil)
+}
@@ -0,0 +1,92 @@
+package format
+
+import (
+	"fmt"
+	"io"
+	"net/netip"
+
+	log "github.com/sirupsen/logrus"
+
+	"github.com/vizv/ipfilter/utils/iprange"
+)
+
+// WriteDat writes intervals in ipfilter.dat format used by qBittorrent and eMule, e.g. "1.0.0.0 - 1.0.0.255 , 0 , ".
+func WriteDat(w io.Writer, intervals iprange.Intervals) error {
+	for _, interval := range intervals {
+		from, to := interval.From, interval.To
+		log.WithFields(log.Fields{"from": from, "to": to}).Tracef("write rule")
+		if _, err := fmt.Fprintf(w, "%s - %s , 0 , \n", from, to); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// WriteP2P writes intervals in P2P (PeerGuardian) format used by Transmission, e.g. "ipfilter:1.0.0.0-1.0.0.255".
+// The format only supports IPv4, IPv6 intervals are skipped.
+func WriteP2P(w io.Writer, intervals iprange.Intervals, description string) error {
+	for _, interval := range intervals {
+		from, to := interval.From.Unmap(), interval.To.Unmap()
+		if !from.Is4() || !to.Is4() {
+			log.WithFields(log.Fields{"from": from, "to": to}).Tracef("skip IPv6 rule")
+			continue
+		}
+		log.WithFields(log.Fields{"from": from, "to": to}).Tracef("write rule")
+		if _, err := fmt.Fprintf(w, "%s:%s-%s\n", description, from, to); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// WriteCIDR writes intervals as CIDR prefixes, one per line, e.g. "1.0.0.0/24".
+func WriteCIDR(w io.Writer, intervals iprange.Intervals) error {
+	for _, interval := range intervals {
+		from, to := interval.From, interval.To
+		log.WithFields(log.Fields{"from": from, "to": to}).Tracef("write rule")
+		for _, prefix := range prefixes(from.Addr, to.Addr) {
+			if _, err := fmt.Fprintf(w, "%s\n", prefix); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// prefixes returns the fewest CIDR prefixes covering addresses from and to, both inclusive.
+func prefixes(from, to netip.Addr) []netip.Prefix {
+	from, to = from.Unmap(), to.Unmap()
+	if !from.IsValid() || !to.IsValid() || from.Is4() != to.Is4() || to.Less(from) {
+		return nil
+	}
+
+	prefixes := []netip.Prefix{}
+	for {
+		// the shortest prefix starting at from and ending no later than to
+		prefix := netip.PrefixFrom(from, from.BitLen())
+		for bits := 0; bits < from.BitLen(); bits++ {
+			candidate := netip.PrefixFrom(from, bits).Masked()
+			if candidate.Addr() == from && !to.Less(lastAddr(candidate)) {
+				prefix = candidate
+				break
+			}
+		}
+		prefixes = append(prefixes, prefix)
+
+		last := lastAddr(prefix)
+		if last == to {
+			return prefixes
+		}
+		from = last.Next()
+	}
+}
+
+// lastAddr returns the last address in the prefix.
+func lastAddr(prefix netip.Prefix) netip.Addr {
+	addr := prefix.Addr().AsSlice()
+	for bit := prefix.Bits(); bit < len(addr)*8; bit++ {
+		addr[bit/8] |= 0x80 >> (bit % 8)
+	}
+	last, _ := netip.AddrFromSlice(addr)
+	return last
+}
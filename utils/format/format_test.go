@@ -0,0 +1,86 @@
+package format
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+
+	"github.com/vizv/ipfilter/utils/iprange"
+)
+
+func testIntervals(t *testing.T, bounds ...string) iprange.Intervals {
+	t.Helper()
+	intervals := iprange.Intervals{}
+	for i := 0; i+1 < len(bounds); i += 2 {
+		before := len(intervals)
+		intervals.Append(bounds[i], bounds[i+1])
+		if len(intervals) == before {
+			t.Fatalf("invalid interval %q - %q", bounds[i], bounds[i+1])
+		}
+	}
+	return intervals
+}
+
+func TestWriteCIDR(t *testing.T) {
+	tests := []struct {
+		name string
+		from string
+		to   string
+		want []string
+	}{
+		{"single address", "1.2.3.4", "1.2.3.4", []string{"1.2.3.4/32"}},
+		{"aligned /24", "1.0.0.0", "1.0.0.255", []string{"1.0.0.0/24"}},
+		{"all IPv4", "0.0.0.0", "255.255.255.255", []string{"0.0.0.0/0"}},
+		{"two addresses across a boundary", "1.0.0.255", "1.0.1.0", []string{"1.0.0.255/32", "1.0.1.0/32"}},
+		{"unaligned start", "1.0.0.1", "1.0.0.7", []string{"1.0.0.1/32", "1.0.0.2/31", "1.0.0.4/30"}},
+		{"unaligned end", "1.0.0.0", "1.0.0.6", []string{"1.0.0.0/30", "1.0.0.4/31", "1.0.0.6/32"}},
+		{"both unaligned", "10.0.0.3", "10.0.2.4", []string{"10.0.0.3/32", "10.0.0.4/30", "10.0.0.8/29", "10.0.0.16/28", "10.0.0.32/27", "10.0.0.64/26", "10.0.0.128/25", "10.0.1.0/24", "10.0.2.0/30", "10.0.2.4/32"}},
+		{"last address", "255.255.255.254", "255.255.255.255", []string{"255.255.255.254/31"}},
+		{"IPv4-mapped IPv6", "::ffff:1.0.0.0", "::ffff:1.0.0.255", []string{"1.0.0.0/24"}},
+		{"IPv6", "2001:db8::", "2001:db8::1:ffff", []string{"2001:db8::/111"}},
+		{"unaligned IPv6", "2001:db8::1", "2001:db8::2", []string{"2001:db8::1/128", "2001:db8::2/128"}},
+		{"reversed", "1.0.0.255", "1.0.0.0", nil},
+		{"mixed families", "1.0.0.0", "2001:db8::", nil},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			buffer := bytes.Buffer{}
+			if err := WriteCIDR(&buffer, testIntervals(t, test.from, test.to)); err != nil {
+				t.Fatalf("WriteCIDR() error: %v", err)
+			}
+			got := strings.Fields(buffer.String())
+			if strings.Join(got, " ") != strings.Join(test.want, " ") {
+				t.Errorf("WriteCIDR(%s - %s) = %v, want %v", test.from, test.to, got, test.want)
+			}
+		})
+	}
+}
+
+func TestWriteP2P(t *testing.T) {
+	buffer := bytes.Buffer{}
+	intervals := testIntervals(t,
+		"1.0.0.0", "1.0.0.255",
+		"::ffff:2.0.0.0", "::ffff:2.0.0.255",
+		"2001:db8::", "2001:db8::ffff",
+	)
+	if err := WriteP2P(&buffer, intervals, "ipfilter"); err != nil {
+		t.Fatalf("WriteP2P() error: %v", err)
+	}
+
+	want := "ipfilter:1.0.0.0-1.0.0.255\nipfilter:2.0.0.0-2.0.0.255\n"
+	if got := buffer.String(); got != want {
+		t.Errorf("WriteP2P() = %q, want %q", got, want)
+	}
+}
+
+func TestWriteDat(t *testing.T) {
+	buffer := bytes.Buffer{}
+	if err := WriteDat(&buffer, testIntervals(t, "1.0.0.0", "1.0.0.255", "2001:db8::", "2001:db8::ffff")); err != nil {
+		t.Fatalf("WriteDat() error: %v", err)
+	}
+
+	want := "1.0.0.0 - 1.0.0.255 , 0 , \n2001:db8:: - 2001:db8::ffff , 0 , \n"
+	if got := buffer.String(); got != want {
+		t.Errorf("WriteDat() = %q, want %q", got, want)
+	}
+}
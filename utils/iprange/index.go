@@ -0,0 +1,87 @@
+package iprange
+
+import (
+	"net/netip"
+	"slices"
+)
+
+// Rule is an interval with its description.
+type Rule struct {
+	Interval
+	Description string
+}
+
+// Index finds the rule containing an IP address with binary search. Unlike Matcher, rules may overlap.
+// IPv4-mapped IPv6 addresses and rules are matched as IPv4.
+type Index struct {
+	v4 indexRules
+	v6 indexRules
+}
+
+type indexRules struct {
+	rules []Rule
+	// maxTo is the maximum upper bound of rules up to the index, to stop searching overlapping rules early
+	maxTo []netip.Addr
+}
+
+// NewIndex creates an index from rules.
+func NewIndex(rules []Rule) *Index {
+	x := &Index{}
+	for _, rule := range rules {
+		rule.Interval = unmap(rule.Interval.Fix())
+		if rule.From.Is4() != rule.To.Is4() {
+			continue
+		}
+		if rule.From.Is4() {
+			x.v4.rules = append(x.v4.rules, rule)
+		} else {
+			x.v6.rules = append(x.v6.rules, rule)
+		}
+	}
+
+	x.v4.build()
+	x.v6.build()
+	return x
+}
+
+func (r *indexRules) build() {
+	slices.SortStableFunc(r.rules, func(a, b Rule) int {
+		return a.From.Compare(b.From.Addr)
+	})
+
+	r.maxTo = make([]netip.Addr, len(r.rules))
+	for i, rule := range r.rules {
+		r.maxTo[i] = rule.To.Addr
+		if i > 0 && r.maxTo[i-1].Compare(rule.To.Addr) > 0 {
+			r.maxTo[i] = r.maxTo[i-1]
+		}
+	}
+}
+
+// Len returns the number of rules.
+func (x *Index) Len() int {
+	return len(x.v4.rules) + len(x.v6.rules)
+}
+
+// Match returns the rule with the greatest lower bound containing the address.
+func (x *Index) Match(addr netip.Addr) (Rule, bool) {
+	addr = addr.Unmap()
+	r := &x.v6
+	if addr.Is4() {
+		r = &x.v4
+	}
+
+	// rules after the last rule starting not after the address never contain it
+	i, _ := slices.BinarySearchFunc(r.rules, addr, func(rule Rule, addr netip.Addr) int {
+		if rule.From.Compare(addr) <= 0 {
+			return -1
+		}
+		return 1
+	})
+	for i -= 1; i >= 0 && r.maxTo[i].Compare(addr) >= 0; i-- {
+		if r.rules[i].To.Compare(addr) >= 0 {
+			return r.rules[i], true
+		}
+	}
+	return Rule{}, false
+}
@@ -0,0 +1,65 @@
+package iprange
+
+import (
+	"net/netip"
+	"testing"
+)
+
+func testRules(t *testing.T, rules ...string) []Rule {
+	t.Helper()
+	result := []Rule{}
+	for i := 0; i+2 < len(rules); i += 3 {
+		interval := testIntervals(t, rules[i], rules[i+1])[0]
+		result = append(result, Rule{interval, rules[i+2]})
+	}
+	return result
+}
+
+func TestIndexMatch(t *testing.T) {
+	index := NewIndex(testRules(t,
+		"10.0.0.0", "10.255.255.255", "wide",
+		"10.1.0.0", "10.1.0.255", "nested",
+		"10.1.0.128", "10.2.0.0", "overlapping",
+		"20.0.0.0", "20.0.0.10", "short",
+		"1.0.0.0", "30.0.0.0", "outer",
+		"::ffff:172.16.0.0", "::ffff:172.16.0.255", "mapped",
+		"2001:db8::", "2001:db8::ffff", "v6",
+		"1.2.3.4", "2001:db8::1", "mixed",
+	))
+	if got := index.Len(); got != 7 {
+		t.Fatalf("Len() = %d, want 7", got)
+	}
+
+	tests := []struct {
+		addr        string
+		description string
+		ok          bool
+	}{
+		{"0.255.255.255", "", false},
+		{"1.0.0.0", "outer", true},
+		{"10.0.0.1", "wide", true},
+		{"10.1.0.1", "nested", true},
+		{"10.1.0.200", "overlapping", true},
+		{"10.1.1.0", "overlapping", true},
+		{"10.2.0.1", "wide", true},
+		{"20.0.0.5", "short", true},
+		// the short rule and the wide rule end early, the earlier outer rule still contains the address
+		{"20.0.0.11", "outer", true},
+		{"30.0.0.1", "", false},
+		{"172.16.0.1", "mapped", true},
+		{"::ffff:172.16.0.1", "mapped", true},
+		{"::ffff:10.1.0.1", "nested", true},
+		{"2001:db8::1", "v6", true},
+		{"2001:db8::1:0", "", false},
+	}
+	for _, test := range tests {
+		rule, ok := index.Match(netip.MustParseAddr(test.addr))
+		if ok != test.ok {
+			t.Errorf("Match(%s) ok = %v, want %v", test.addr, ok, test.ok)
+			continue
+		}
+		if ok && rule.Description != test.description {
+			t.Errorf("Match(%s) = %q, want %q", test.addr, rule.Description, test.description)
+		}
+	}
+}
@@ -51,6 +51,13 @@ func (i Interval) Fix() Interval {
 	return i
 }
 
+// Size returns the number of addresses in the receiving interval.
+func (i Interval) Size() *big.Int {
+	i = i.Fix()
+	size := big.NewInt(0).Sub(i.To.ToInt().Int, i.From.ToInt().Int)
+	return size.Add(size, big.NewInt(1))
+}
+
 // String returns a human-readable representation of the receiving interval.
 func (i Interval) String() string {
 	return fmt.Sprintf("[%v, %v]", i.From, i.To)
@@ -0,0 +1,75 @@
+package iprange
+
+import (
+	"net/netip"
+	"slices"
+)
+
+// Matcher finds the interval containing an IP address with binary search. IPv4 and IPv6 intervals are kept apart,
+// and IPv4-mapped IPv6 addresses and intervals are matched as IPv4.
+type Matcher struct {
+	v4 Intervals
+	v6 Intervals
+}
+
+// NewMatcher creates a matcher from merged intervals.
+func NewMatcher(intervals Intervals) *Matcher {
+	m := &Matcher{}
+	for _, interval := range intervals {
+		interval = unmap(interval.Fix())
+		if interval.From.Is4() != interval.To.Is4() {
+			continue
+		}
+		if interval.From.Is4() {
+			m.v4 = append(m.v4, interval)
+		} else {
+			m.v6 = append(m.v6, interval)
+		}
+	}
+
+	compare := func(a, b Interval) int {
+		return a.From.Compare(b.From.Addr)
+	}
+	slices.SortFunc(m.v4, compare)
+	slices.SortFunc(m.v6, compare)
+
+	return m
+}
+
+// unmap converts an interval of IPv4-mapped IPv6 addresses to IPv4, so it is matched as IPv4.
+func unmap(interval Interval) Interval {
+	if interval.From.Is4In6() && interval.To.Is4In6() {
+		interval.From, interval.To = &IP{interval.From.Unmap()}, &IP{interval.To.Unmap()}
+	}
+	return interval
+}
+
+// Len returns the number of intervals.
+func (m *Matcher) Len() int {
+	return len(m.v4) + len(m.v6)
+}
+
+// Match returns the interval containing the address.
+func (m *Matcher) Match(addr netip.Addr) (Interval, bool) {
+	addr = addr.Unmap()
+	intervals := m.v6
+	if addr.Is4() {
+		intervals = m.v4
+	}
+
+	// find the last interval starting not after the address
+	i, found := slices.BinarySearchFunc(intervals, addr, func(interval Interval, addr netip.Addr) int {
+		return interval.From.Compare(addr)
+	})
+	if !found {
+		i -= 1
+	}
+	if i < 0 {
+		return Interval{}, false
+	}
+
+	if intervals[i].To.Compare(addr) < 0 {
+		return Interval{}, false
+	}
+	return intervals[i], true
+}
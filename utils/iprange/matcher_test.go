@@ -0,0 +1,79 @@
+package iprange
+
+import (
+	"net/netip"
+	"testing"
+)
+
+func testIntervals(t *testing.T, bounds ...string) Intervals {
+	t.Helper()
+	intervals := Intervals{}
+	for i := 0; i+1 < len(bounds); i += 2 {
+		from, err := ParseIP(bounds[i])
+		if err != nil {
+			t.Fatalf("invalid IP %q: %v", bounds[i], err)
+		}
+		to, err := ParseIP(bounds[i+1])
+		if err != nil {
+			t.Fatalf("invalid IP %q: %v", bounds[i+1], err)
+		}
+		intervals = append(intervals, Interval{from, to})
+	}
+	return intervals
+}
+
+func TestMatcherMatch(t *testing.T) {
+	matcher := NewMatcher(testIntervals(t,
+		"10.0.0.0", "10.0.0.255",
+		"1.0.0.255", "1.0.0.0", // swapped bounds
+		"192.168.1.1", "192.168.1.1",
+		"::ffff:172.16.0.0", "::ffff:172.16.255.255",
+		"2001:db8::", "2001:db8::ffff",
+		"1.2.3.4", "2001:db8::1", // mixed families are dropped
+	))
+	if got := matcher.Len(); got != 5 {
+		t.Fatalf("Len() = %d, want 5", got)
+	}
+
+	tests := []struct {
+		addr string
+		from string
+		ok   bool
+	}{
+		{"10.0.0.0", "10.0.0.0", true},
+		{"10.0.0.128", "10.0.0.0", true},
+		{"10.0.0.255", "10.0.0.0", true},
+		{"10.0.1.0", "", false},
+		{"9.255.255.255", "", false},
+		{"1.0.0.1", "1.0.0.0", true},
+		{"0.255.255.255", "", false},
+		{"192.168.1.1", "192.168.1.1", true},
+		{"192.168.1.2", "", false},
+		{"::ffff:10.0.0.1", "10.0.0.0", true},
+		{"172.16.1.1", "172.16.0.0", true},
+		{"::ffff:172.16.1.1", "172.16.0.0", true},
+		{"2001:db8::1", "2001:db8::", true},
+		{"2001:db8::1:0", "", false},
+		{"::a00:1", "", false}, // 10.0.0.1 bits as IPv6
+		{"1.2.3.4", "", false},
+	}
+	for _, test := range tests {
+		interval, ok := matcher.Match(netip.MustParseAddr(test.addr))
+		if ok != test.ok {
+			t.Errorf("Match(%s) ok = %v, want %v", test.addr, ok, test.ok)
+			continue
+		}
+		if ok && interval.From.String() != test.from {
+			t.Errorf("Match(%s) = %s, want interval from %s", test.addr, interval, test.from)
+		}
+	}
+}
+
+func TestMatcherEmpty(t *testing.T) {
+	matcher := NewMatcher(nil)
+	for _, addr := range []string{"0.0.0.0", "255.255.255.255", "::", "2001:db8::1"} {
+		if interval, ok := matcher.Match(netip.MustParseAddr(addr)); ok {
+			t.Errorf("Match(%s) = %s, want no match", addr, interval)
+		}
+	}
+}
@@ -0,0 +1,111 @@
+package logging
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"strings"
+
+	"github.com/mattn/go-colorable"
+	"github.com/mattn/go-isatty"
+	log "github.com/sirupsen/logrus"
+)
+
+const (
+	// FormatText is human readable, colored when writing to a terminal.
+	FormatText = "text"
+	// FormatJSON writes one JSON object per entry.
+	FormatJSON = "json"
+	// FormatLogfmt writes key=value pairs, never colored.
+	FormatLogfmt = "logfmt"
+)
+
+var Formats = []string{FormatText, FormatJSON, FormatLogfmt}
+
+// DEFAULT_MAX_SIZE is the size in megabytes after which the log file is rotated.
+const DEFAULT_MAX_SIZE = 10
+
+// DEFAULT_MAX_BACKUPS is the number of rotated log files kept.
+const DEFAULT_MAX_BACKUPS = 3
+
+// Stable field names of log entries, so entries can be queried by field in JSON and logfmt formats.
+const (
+	// FieldURL is the URL of a source, or of a target.
+	FieldURL = "url"
+	// FieldCache is the cache file of a source.
+	FieldCache = "cache"
+	// FieldFile is a file read, e.g. an ipfilter.dat file rules are collected from, or the config file.
+	FieldFile = "file"
+	// FieldSlot is the file name of a slot.
+	FieldSlot = "slot"
+	// FieldRules is a number of rules.
+	FieldRules = "rules"
+)
+
+// Options configure the format and output of logs.
+type Options struct {
+	Format string
+	// File to write logs to instead of stdout, empty for stdout.
+	File string
+	// MaxSize in bytes after which the log file is rotated, 0 to never rotate.
+	MaxSize int64
+	// MaxBackups is the number of rotated log files kept.
+	MaxBackups int
+}
+
+// output is the current log file, closed when the output changes.
+var output io.Closer
+
+// Setup sets the format and output of the standard logger.
+func Setup(options Options) error {
+	var out io.Writer
+	var file *RotatingFile
+	if options.File != "" {
+		var err error
+		if file, err = OpenRotatingFile(options.File, options.MaxSize, options.MaxBackups); err != nil {
+			return err
+		}
+		out = file
+	} else {
+		out = colorable.NewColorableStdout()
+	}
+
+	formatter, err := newFormatter(options.Format, file == nil && colorSupported(os.Stdout))
+	if err != nil {
+		if file != nil {
+			file.Close()
+		}
+		return err
+	}
+
+	log.SetFormatter(formatter)
+	log.SetOutput(out)
+	if output != nil {
+		output.Close()
+		output = nil
+	}
+	if file != nil {
+		output = file
+	}
+	return nil
+}
+
+func newFormatter(format string, colored bool) (log.Formatter, error) {
+	switch format {
+	case FormatText, "":
+		return &log.TextFormatter{ForceColors: colored, DisableColors: !colored}, nil
+	case FormatJSON:
+		return &log.JSONFormatter{}, nil
+	case FormatLogfmt:
+		return &log.TextFormatter{DisableColors: true}, nil
+	}
+	return nil, fmt.Errorf("unknown log format %q, must be one of %s", format, strings.Join(Formats, ", "))
+}
+
+// colorSupported returns true if the file is a terminal, and colors are not disabled by $NO_COLOR or $TERM=dumb.
+func colorSupported(file *os.File) bool {
+	if os.Getenv("NO_COLOR") != "" || os.Getenv("TERM") == "dumb" {
+		return false
+	}
+	return isatty.IsTerminal(file.Fd()) || isatty.IsCygwinTerminal(file.Fd())
+}
@@ -0,0 +1,214 @@
+package metrics
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+
+	log "github.com/sirupsen/logrus"
+)
+
+const (
+	KindCounter = "counter"
+	KindGauge   = "gauge"
+	KindSummary = "summary"
+)
+
+// labelSeparator joins label values to the key of a series, it never appears in valid UTF-8.
+const labelSeparator = "\xff"
+
+// Registry collects metrics, and serves them in the Prometheus text exposition format.
+type Registry struct {
+	mu       sync.Mutex
+	families []*Family
+}
+
+// Default is the registry used by NewCounter, NewGauge and NewSummary.
+var Default = &Registry{}
+
+// Family is a metric with values for each combination of label values.
+type Family struct {
+	registry *Registry
+	name     string
+	help     string
+	kind     string
+	labels   []string
+	series   map[string]*series
+}
+
+type series struct {
+	labelValues []string
+	value       float64
+	count       uint64
+}
+
+func NewCounter(name, help string, labels ...string) *Family {
+	return Default.Register(name, help, KindCounter, labels...)
+}
+
+func NewGauge(name, help string, labels ...string) *Family {
+	return Default.Register(name, help, KindGauge, labels...)
+}
+
+// NewSummary creates a summary without quantiles, only the sum and count of observations are kept.
+func NewSummary(name, help string, labels ...string) *Family {
+	return Default.Register(name, help, KindSummary, labels...)
+}
+
+// Register creates a metric family in the registry.
+func (r *Registry) Register(name, help, kind string, labels ...string) *Family {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	f := &Family{registry: r, name: name, help: help, kind: kind, labels: labels, series: map[string]*series{}}
+	r.families = append(r.families, f)
+	return f
+}
+
+// Inc increases a counter by 1.
+func (f *Family) Inc(labelValues ...string) {
+	f.Add(1, labelValues...)
+}
+
+// Add increases a counter, or a gauge.
+func (f *Family) Add(delta float64, labelValues ...string) {
+	f.update(labelValues, func(s *series) {
+		s.value += delta
+	})
+}
+
+// Set sets a gauge.
+func (f *Family) Set(value float64, labelValues ...string) {
+	f.update(labelValues, func(s *series) {
+		s.value = value
+	})
+}
+
+// Observe adds an observation to a summary.
+func (f *Family) Observe(value float64, labelValues ...string) {
+	f.update(labelValues, func(s *series) {
+		s.value += value
+		s.count += 1
+	})
+}
+
+// DeleteLabel removes all series with the label value, e.g. of a source no longer configured.
+func (f *Family) DeleteLabel(label, value string) {
+	i := -1
+	for j, name := range f.labels {
+		if name == label {
+			i = j
+		}
+	}
+	if i < 0 {
+		return
+	}
+
+	f.registry.mu.Lock()
+	defer f.registry.mu.Unlock()
+	for key, s := range f.series {
+		if s.labelValues[i] == value {
+			delete(f.series, key)
+		}
+	}
+}
+
+func (f *Family) update(labelValues []string, update func(s *series)) {
+	if len(labelValues) != len(f.labels) {
+		log.WithField("metric", f.name).Warnf("expected %d label values, got %d", len(f.labels), len(labelValues))
+		return
+	}
+
+	f.registry.mu.Lock()
+	defer f.registry.mu.Unlock()
+	key := strings.Join(labelValues, labelSeparator)
+	s, ok := f.series[key]
+	if !ok {
+		s = &series{labelValues: append([]string{}, labelValues...)}
+		f.series[key] = s
+	}
+	update(s)
+}
+
+// WriteTo writes all metrics with at least one series in the text exposition format.
+func (r *Registry) WriteTo(w io.Writer) (int64, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	cw := &countingWriter{w: w}
+	bw := bufio.NewWriter(cw)
+	for _, f := range r.families {
+		if len(f.series) == 0 {
+			continue
+		}
+
+		fmt.Fprintf(bw, "# HELP %s %s\n", f.name, escapeHelp(f.help))
+		fmt.Fprintf(bw, "# TYPE %s %s\n", f.name, f.kind)
+		keys := make([]string, 0, len(f.series))
+		for key := range f.series {
+			keys = append(keys, key)
+		}
+		sort.Strings(keys)
+
+		for _, key := range keys {
+			s := f.series[key]
+			labels := formatLabels(f.labels, s.labelValues)
+			if f.kind == KindSummary {
+				fmt.Fprintf(bw, "%s_sum%s %s\n", f.name, labels, formatValue(s.value))
+				fmt.Fprintf(bw, "%s_count%s %d\n", f.name, labels, s.count)
+				continue
+			}
+			fmt.Fprintf(bw, "%s%s %s\n", f.name, labels, formatValue(s.value))
+		}
+	}
+
+	err := bw.Flush()
+	return cw.n, err
+}
+
+func (r *Registry) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+	if _, err := r.WriteTo(w); err != nil {
+		log.Debugf("failed to write metrics: %v", err)
+	}
+}
+
+func formatLabels(names, values []string) string {
+	if len(names) == 0 {
+		return ""
+	}
+
+	pairs := make([]string, len(names))
+	for i, name := range names {
+		pairs[i] = fmt.Sprintf(`%s="%s"`, name, escapeLabelValue(values[i]))
+	}
+	return "{" + strings.Join(pairs, ",") + "}"
+}
+
+func formatValue(value float64) string {
+	return strconv.FormatFloat(value, 'g', -1, 64)
+}
+
+func escapeHelp(help string) string {
+	return strings.NewReplacer(`\`, `\\`, "\n", `\n`).Replace(help)
+}
+
+func escapeLabelValue(value string) string {
+	return strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`).Replace(value)
+}
+
+type countingWriter struct {
+	w io.Writer
+	n int64
+}
+
+func (c *countingWriter) Write(p []byte) (int, error) {
+	n, err := c.w.Write(p)
+	c.n += int64(n)
+	return n, err
+}
@@ -6,39 +6,75 @@ import (
 	"strings"
 
 	log "github.com/sirupsen/logrus"
+
+	"github.com/vizv/ipfilter/utils/logging"
 )
 
+// Rule is a line in ipfilter.dat, e.g. "1.0.0.0 - 1.0.0.255 , 0 , description".
+type Rule struct {
+	From        string
+	To          string
+	Description string
+}
+
 func ParseIPFilterDatFile(filename string) <-chan [2]string {
 	ch := make(chan [2]string)
 
 	go func() {
 		defer close(ch)
+		scanIPFilterDatFile(filename, func(rule Rule) {
+			ch <- [2]string{rule.From, rule.To}
+		})
+	}()
 
-		file, err := os.Open(filename)
-		if err != nil {
-			log.WithField("filename", filename).Warnf("failed to open file: %+v", err)
-			return
-		}
-		defer file.Close()
+	return ch
+}
 
-		scanner := bufio.NewScanner(file)
-		for scanner.Scan() {
-			line := scanner.Text()
+// ParseIPFilterDatRules parses rules with their descriptions.
+func ParseIPFilterDatRules(filename string) <-chan Rule {
+	ch := make(chan Rule)
+
+	go func() {
+		defer close(ch)
+		scanIPFilterDatFile(filename, func(rule Rule) {
+			ch <- rule
+		})
+	}()
 
-			parts := strings.SplitN(line, ",", 2)
-			ips := strings.SplitN(parts[0], "-", 3)
+	return ch
+}
 
-			from := strings.TrimSpace(ips[0])
-			to := strings.TrimSpace(ips[1])
+func scanIPFilterDatFile(filename string, emit func(rule Rule)) {
+	file, err := os.Open(filename)
+	if err != nil {
+		log.WithField(logging.FieldFile, filename).Warnf("failed to open file: %+v", err)
+		return
+	}
+	defer file.Close()
 
-			ch <- [2]string{from, to}
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		if rule, ok := parseLine(scanner.Text()); ok {
+			emit(rule)
 		}
+	}
 
-		if err := scanner.Err(); err != nil {
-			log.WithField("filename", filename).Warnf("failed to read file: %+v", err)
-			return
-		}
-	}()
+	if err := scanner.Err(); err != nil {
+		log.WithField(logging.FieldFile, filename).Warnf("failed to read file: %+v", err)
+		return
+	}
+}
 
-	return ch
+func parseLine(line string) (Rule, bool) {
+	parts := strings.SplitN(line, ",", 3)
+	ips := strings.SplitN(parts[0], "-", 3)
+	if len(ips) < 2 {
+		return Rule{}, false
+	}
+
+	rule := Rule{From: strings.TrimSpace(ips[0]), To: strings.TrimSpace(ips[1])}
+	if len(parts) == 3 {
+		rule.Description = strings.TrimSpace(parts[2])
+	}
+	return rule, true
 }
@@ -1,18 +1,25 @@
 package qb
 
 import (
+	"encoding/json"
 	"fmt"
 	"io"
 	"net/http"
 	"net/http/cookiejar"
 	"net/url"
 	"strings"
+	"time"
 
 	log "github.com/sirupsen/logrus"
 )
 
+// DEFAULT_TIMEOUT limits every request to the WebUI, so an unresponsive WebUI does not block the caller.
+const DEFAULT_TIMEOUT = 30 * time.Second
+
 type Client struct {
-	BaseURL string
+	BaseURL  string
+	username string
+	password string
 	http.Client
 }
 
@@ -26,55 +33,157 @@ func NewClient(webUIURL *url.URL) (*Client, error) {
 		return nil, fmt.Errorf("error creating cookie jar: %v", err)
 	}
 
-	client := http.Client{Jar: jar}
-
 	username := webUIURL.User.Username()
 	password, passwordSet := webUIURL.User.Password()
-	webUIURL.User = nil
-	baseURL := webUIURL.String()
+	clientURL := *webUIURL
+	clientURL.User = nil
+	client := &Client{BaseURL: clientURL.String(), Client: http.Client{Jar: jar, Timeout: DEFAULT_TIMEOUT}}
 	if passwordSet && username != "" && password != "" {
-		log.Infof("credentials found, performing login...")
-		loginData := url.Values{}
-		loginData.Set("username", username)
-		loginData.Set("password", password)
+		client.username, client.password = username, password
 
-		loginResp, err := client.PostForm(baseURL+"/api/v2/auth/login", loginData)
-		if err != nil {
-			return nil, fmt.Errorf("error logging in: %v", err)
+		log.Infof("credentials found, performing login...")
+		if err := client.login(); err != nil {
+			return nil, err
 		}
-		defer loginResp.Body.Close()
 	} else {
 		log.Infof("credentials not found, will not login")
 	}
 
-	return &Client{baseURL, client}, nil
+	return client, nil
+}
+
+// login authenticates with the WebUI, qBittorrent answers "Ok." on success and "Fails." on wrong credentials.
+func (c *Client) login() error {
+	loginData := url.Values{}
+	loginData.Set("username", c.username)
+	loginData.Set("password", c.password)
+
+	loginResp, err := c.PostForm(c.BaseURL+"/api/v2/auth/login", loginData)
+	if err != nil {
+		return fmt.Errorf("error logging in: %v", err)
+	}
+	defer loginResp.Body.Close()
+
+	loginBody, err := io.ReadAll(loginResp.Body)
+	if err != nil {
+		return fmt.Errorf("error reading login response: %v", err)
+	}
+	if loginResp.StatusCode == http.StatusForbidden {
+		return fmt.Errorf("error logging in: IP banned for too many failed login attempts")
+	}
+	if loginResp.StatusCode != 200 {
+		return fmt.Errorf("error logging in: %d - %s", loginResp.StatusCode, string(loginBody))
+	}
+	if result := strings.TrimSpace(string(loginBody)); result != "Ok." {
+		return fmt.Errorf("error logging in: %s", result)
+	}
+
+	return nil
+}
+
+// retry performs the request, and performs it once again after login if the session is expired.
+func (c *Client) retry(request func() (*http.Response, error)) (*http.Response, error) {
+	resp, err := request()
+	if err != nil || resp.StatusCode != http.StatusForbidden || c.username == "" {
+		return resp, err
+	}
+	resp.Body.Close()
+
+	log.Infof("session expired, performing login...")
+	if err := c.login(); err != nil {
+		return nil, err
+	}
+	return request()
+}
+
+func (c *Client) get(path string) (*http.Response, error) {
+	return c.retry(func() (*http.Response, error) {
+		return c.Get(c.BaseURL + path)
+	})
+}
+
+func (c *Client) postForm(path string, data url.Values) (*http.Response, error) {
+	return c.retry(func() (*http.Response, error) {
+		return c.PostForm(c.BaseURL+path, data)
+	})
+}
+
+// Preferences contains the qBittorrent preferences used by ipfilter.
+type Preferences struct {
+	IPFilterEnabled  bool   `json:"ip_filter_enabled"`
+	IPFilterPath     string `json:"ip_filter_path"`
+	IPFilterTrackers bool   `json:"ip_filter_trackers"`
+	BannedIPs        string `json:"banned_IPs"`
 }
 
-func (c *Client) GetPreferences() (string, error) {
-	prefResp, err := c.Get(c.BaseURL + "/api/v2/app/preferences")
+func (c *Client) GetPreferences() (*Preferences, error) {
+	prefResp, err := c.get("/api/v2/app/preferences")
 	if err != nil {
-		return "", fmt.Errorf("error getting preferences: %v", err)
+		return nil, fmt.Errorf("error getting preferences: %v", err)
 	}
 	defer prefResp.Body.Close()
 
 	prefBody, err := io.ReadAll(prefResp.Body)
 	if err != nil {
-		return "", fmt.Errorf("error parsing preferences: %v", err)
+		return nil, fmt.Errorf("error reading preferences: %v", err)
 	}
 	if prefResp.StatusCode != 200 {
-		return "", fmt.Errorf("error getting preferences: %d - %s", prefResp.StatusCode, string(prefBody))
+		return nil, fmt.Errorf("error getting preferences: %d - %s", prefResp.StatusCode, string(prefBody))
 	}
-	return string(prefBody), nil
+
+	prefs := &Preferences{}
+	if err := json.Unmarshal(prefBody, prefs); err != nil {
+		return nil, fmt.Errorf("error parsing preferences: %v", err)
+	}
+	return prefs, nil
 }
 
-func (c *Client) RefreshIPFilter(newFilterPath string) error {
+// SetPreferences sets the preferences encoded from prefs, which usually only contains the preferences to be changed.
+func (c *Client) SetPreferences(prefs any) error {
+	prefJson, err := json.Marshal(prefs)
+	if err != nil {
+		return fmt.Errorf("error encoding preferences: %v", err)
+	}
+
 	setPrefData := url.Values{}
-	setPrefData.Set("json", fmt.Sprintf(`{"ip_filter_enabled":true,"ip_filter_path":"%s"}`, strings.ReplaceAll(newFilterPath, `\`, `\\`)))
-	setPrefResp, err := c.PostForm(c.BaseURL+"/api/v2/app/setPreferences", setPrefData)
+	setPrefData.Set("json", string(prefJson))
+	setPrefResp, err := c.postForm("/api/v2/app/setPreferences", setPrefData)
 	if err != nil {
 		return fmt.Errorf("error setting preferences: %v", err)
 	}
 	defer setPrefResp.Body.Close()
 
+	if setPrefResp.StatusCode != 200 {
+		setPrefBody, _ := io.ReadAll(setPrefResp.Body)
+		return fmt.Errorf("error setting preferences: %d - %s", setPrefResp.StatusCode, string(setPrefBody))
+	}
+
 	return nil
 }
+
+type ipFilterPreferences struct {
+	IPFilterEnabled bool   `json:"ip_filter_enabled"`
+	IPFilterPath    string `json:"ip_filter_path"`
+}
+
+// RefreshIPFilter enables IP filter with the new filter path, and confirms the preferences are applied.
+func (c *Client) RefreshIPFilter(newFilterPath string) error {
+	if err := c.SetPreferences(ipFilterPreferences{true, newFilterPath}); err != nil {
+		return err
+	}
+
+	prefs, err := c.GetPreferences()
+	if err != nil {
+		return fmt.Errorf("error confirming preferences: %v", err)
+	}
+	if !prefs.IPFilterEnabled || !samePath(prefs.IPFilterPath, newFilterPath) {
+		return fmt.Errorf("preferences not applied: ip_filter_enabled = %t, ip_filter_path = %s", prefs.IPFilterEnabled, prefs.IPFilterPath)
+	}
+
+	return nil
+}
+
+// samePath compares paths regardless of path separators, qBittorrent may convert them on Windows.
+func samePath(a, b string) bool {
+	return strings.ReplaceAll(a, `\`, "/") == strings.ReplaceAll(b, `\`, "/")
+}
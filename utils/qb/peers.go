@@ -0,0 +1,107 @@
+package qb
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/url"
+	"strings"
+)
+
+type Torrent struct {
+	Hash string `json:"hash"`
+	Name string `json:"name"`
+}
+
+type Peer struct {
+	IP         string `json:"ip"`
+	Port       int    `json:"port"`
+	Client     string `json:"client"`
+	Country    string `json:"country"`
+	Connection string `json:"connection"`
+}
+
+type torrentPeers struct {
+	Peers map[string]Peer `json:"peers"`
+}
+
+func (c *Client) getJson(path string, v any) error {
+	resp, err := c.get(path)
+	if err != nil {
+		return fmt.Errorf("error requesting %s: %v", path, err)
+	}
+	defer resp.Body.Close()
+
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return fmt.Errorf("error reading %s: %v", path, err)
+	}
+	if resp.StatusCode != 200 {
+		return fmt.Errorf("error requesting %s: %d - %s", path, resp.StatusCode, string(body))
+	}
+
+	if err := json.Unmarshal(body, v); err != nil {
+		return fmt.Errorf("error parsing %s: %v", path, err)
+	}
+	return nil
+}
+
+// GetTorrents returns all torrents.
+func (c *Client) GetTorrents() ([]Torrent, error) {
+	torrents := []Torrent{}
+	if err := c.getJson("/api/v2/torrents/info", &torrents); err != nil {
+		return nil, err
+	}
+	return torrents, nil
+}
+
+// GetTorrentPeers returns peers currently connected for the torrent, keyed by "IP:PORT".
+func (c *Client) GetTorrentPeers(hash string) (map[string]Peer, error) {
+	query := url.Values{}
+	query.Set("hash", hash)
+	query.Set("rid", "0")
+
+	peers := torrentPeers{}
+	if err := c.getJson("/api/v2/sync/torrentPeers?"+query.Encode(), &peers); err != nil {
+		return nil, err
+	}
+	return peers.Peers, nil
+}
+
+// BanPeers bans peers permanently, each peer is "IP:PORT" or "[IPv6]:PORT".
+func (c *Client) BanPeers(peers []string) error {
+	banData := url.Values{}
+	banData.Set("peers", strings.Join(peers, "|"))
+
+	banResp, err := c.postForm("/api/v2/transfer/banPeers", banData)
+	if err != nil {
+		return fmt.Errorf("error banning peers: %v", err)
+	}
+	defer banResp.Body.Close()
+
+	if banResp.StatusCode != 200 {
+		banBody, _ := io.ReadAll(banResp.Body)
+		return fmt.Errorf("error banning peers: %d - %s", banResp.StatusCode, string(banBody))
+	}
+	return nil
+}
+
+type bannedIPsPreferences struct {
+	BannedIPs string `json:"banned_IPs"`
+}
+
+// BannedIPList returns the manually banned IP addresses in the preferences, which are one per line.
+func (p *Preferences) BannedIPList() []string {
+	ips := []string{}
+	for _, ip := range strings.Split(p.BannedIPs, "\n") {
+		if ip = strings.TrimSpace(ip); ip != "" {
+			ips = append(ips, ip)
+		}
+	}
+	return ips
+}
+
+// SetBannedIPs replaces the manually banned IP addresses.
+func (c *Client) SetBannedIPs(ips []string) error {
+	return c.SetPreferences(bannedIPsPreferences{strings.Join(ips, "\n")})
+}
@@ -0,0 +1,132 @@
+package transmission
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"time"
+)
+
+const sessionIDHeader = "X-Transmission-Session-Id"
+
+// DEFAULT_TIMEOUT limits every RPC call including blocklist-update, so an unresponsive Transmission does not block
+// the caller.
+const DEFAULT_TIMEOUT = 60 * time.Second
+
+// Client calls Transmission RPC, the CSRF protection session id is negotiated on the first call.
+type Client struct {
+	URL       string
+	username  string
+	password  string
+	sessionID string
+	http.Client
+}
+
+type request struct {
+	Method    string `json:"method"`
+	Arguments any    `json:"arguments,omitempty"`
+}
+
+type response struct {
+	Result    string          `json:"result"`
+	Arguments json.RawMessage `json:"arguments"`
+}
+
+// NewClient creates a client for the RPC URL, e.g. http://localhost:9091/transmission/rpc, with optional credentials
+// for basic authentication in the URL.
+func NewClient(rpcURL *url.URL) *Client {
+	username := rpcURL.User.Username()
+	password, _ := rpcURL.User.Password()
+	clientURL := *rpcURL
+	clientURL.User = nil
+
+	return &Client{URL: clientURL.String(), username: username, password: password, Client: http.Client{Timeout: DEFAULT_TIMEOUT}}
+}
+
+func (c *Client) post(body []byte) (*http.Response, error) {
+	req, err := http.NewRequest(http.MethodPost, c.URL, bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set(sessionIDHeader, c.sessionID)
+	if c.username != "" {
+		req.SetBasicAuth(c.username, c.password)
+	}
+
+	return c.Do(req)
+}
+
+// Call calls the RPC method, and decodes the arguments of the response to result if not nil.
+func (c *Client) Call(method string, arguments any, result any) error {
+	body, err := json.Marshal(request{method, arguments})
+	if err != nil {
+		return fmt.Errorf("error encoding %s request: %v", method, err)
+	}
+
+	resp, err := c.post(body)
+	if err != nil {
+		return fmt.Errorf("error calling %s: %v", method, err)
+	}
+	if resp.StatusCode == http.StatusConflict {
+		// session id expired or not negotiated yet, retry with the new one
+		resp.Body.Close()
+		c.sessionID = resp.Header.Get(sessionIDHeader)
+		if resp, err = c.post(body); err != nil {
+			return fmt.Errorf("error calling %s: %v", method, err)
+		}
+	}
+	defer resp.Body.Close()
+
+	respBody, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return fmt.Errorf("error reading %s response: %v", method, err)
+	}
+	if resp.StatusCode == http.StatusUnauthorized {
+		return fmt.Errorf("error calling %s: unauthorized, check username and password", method)
+	}
+	if resp.StatusCode != 200 {
+		return fmt.Errorf("error calling %s: %d - %s", method, resp.StatusCode, string(respBody))
+	}
+
+	rpcResp := response{}
+	if err := json.Unmarshal(respBody, &rpcResp); err != nil {
+		return fmt.Errorf("error parsing %s response: %v", method, err)
+	}
+	if rpcResp.Result != "success" {
+		return fmt.Errorf("error calling %s: %s", method, rpcResp.Result)
+	}
+	if result != nil {
+		if err := json.Unmarshal(rpcResp.Arguments, result); err != nil {
+			return fmt.Errorf("error parsing %s arguments: %v", method, err)
+		}
+	}
+
+	return nil
+}
+
+type blocklistSession struct {
+	BlocklistEnabled bool   `json:"blocklist-enabled"`
+	BlocklistURL     string `json:"blocklist-url"`
+}
+
+type blocklistUpdateResult struct {
+	BlocklistSize int `json:"blocklist-size"`
+}
+
+// RefreshBlocklist enables the blocklist with the URL, which may be a file:// URL, then asks Transmission to update
+// the blocklist from it, and returns the number of rules loaded.
+func (c *Client) RefreshBlocklist(blocklistURL string) (int, error) {
+	if err := c.Call("session-set", blocklistSession{true, blocklistURL}, nil); err != nil {
+		return 0, err
+	}
+
+	result := blocklistUpdateResult{}
+	if err := c.Call("blocklist-update", nil, &result); err != nil {
+		return 0, err
+	}
+	return result.BlocklistSize, nil
+}